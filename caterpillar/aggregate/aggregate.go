@@ -0,0 +1,233 @@
+package aggregate
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/nydus"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//Caterpillar computes the aggregations described in its type-config (see GetSpec) for each group, in fixed time buckets.
+type Caterpillar struct {
+	outChan chan nydus.BulkRecordEntry
+	index   string
+	rectype string
+
+	spec Spec
+
+	GobRegisterOnce sync.Once
+}
+
+//Bucket is a group's running aggregation for its current bucket, kept in the caterpillar's state (see timebucket).
+type Bucket struct {
+	Start time.Time
+	Group []string
+
+	Count    int
+	Numeric  int //number of events with a numeric value, used for min, max and avg.
+	Sum      float64
+	Min      float64
+	Max      float64
+	Distinct map[string]map[string]bool //field -> values seen
+}
+
+//GetCaterpillar .
+func GetCaterpillar() (ci.Caterpillar, *nerr.E) {
+	return &Caterpillar{}, nil
+}
+
+//Run fulfils the Caterpillar interface.
+func (c *Caterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, cnfg config.Caterpillar, GetData func(int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
+	index, ok := cnfg.TypeConfig["output-index"]
+	if !ok {
+		return state, nerr.Create(fmt.Sprintf("Missing config item for Caterpillar type %v. Need output-index", cnfg.Type), "invalid-config")
+	}
+
+	c.index = index
+	c.outChan = outChan
+	c.rectype = "metrics"
+	if v, ok := cnfg.TypeConfig["output-type"]; ok && len(v) > 0 {
+		c.rectype = v
+	}
+
+	var err *nerr.E
+	c.spec, err = GetSpec(cnfg.TypeConfig)
+	if err != nil {
+		return state, err.Addf("Couldn't run aggregate caterpillar %v", id)
+	}
+
+	buckets := map[string]Bucket{}
+	if v, ok := state.Data.(map[string]Bucket); ok {
+		buckets = v
+	}
+
+	inchan, err := GetData(1000)
+	if err != nil {
+		return state, err.Addf("Couldn't run aggregate caterpillar %v", id)
+	}
+
+	lastTime := state.LastEventTime
+	for i := range inchan {
+		e, ok := i.(events.Event)
+		if !ok {
+			log.L.Warnf("Unkown type in channel %v", i)
+			continue
+		}
+		lastTime = e.Timestamp
+
+		if len(c.spec.Keys) > 0 && !c.spec.Keys[e.Key] {
+			continue
+		}
+
+		group := c.spec.group(e)
+		k := strings.Join(group, "\x00")
+
+		cur, done := c.spec.Add(buckets[k], group, e)
+		buckets[k] = cur
+		if done != nil {
+			c.send(c.spec.Record(*done))
+		}
+	}
+
+	for k, v := range buckets {
+		if !c.spec.Interval.Ended(v.Start, lastTime) {
+			continue
+		}
+		c.send(c.spec.Record(v))
+		delete(buckets, k)
+	}
+
+	return config.State{
+		LastEventTime: lastTime,
+		Data:          buckets,
+	}, nil
+}
+
+func (s Spec) group(e events.Event) []string {
+	toReturn := []string{}
+	for _, f := range s.GroupBy {
+		toReturn = append(toReturn, fields[f.Name](e))
+	}
+	return toReturn
+}
+
+//Add adds the event to the group's bucket. If the event falls in a new bucket, the finished bucket is returned.
+func (s Spec) Add(cur Bucket, group []string, e events.Event) (Bucket, *Bucket) {
+	var toReturn *Bucket
+
+	start := s.Interval.Start(e.Timestamp)
+	if !cur.Start.Equal(start) {
+		if !cur.Start.IsZero() {
+			done := cur
+			toReturn = &done
+		}
+		cur = Bucket{Start: start, Group: group, Distinct: map[string]map[string]bool{}}
+	}
+
+	cur.Count++
+
+	if v, err := strconv.ParseFloat(strings.TrimSpace(e.Value), 64); err == nil {
+		if cur.Numeric == 0 || v < cur.Min {
+			cur.Min = v
+		}
+		if cur.Numeric == 0 || v > cur.Max {
+			cur.Max = v
+		}
+		cur.Sum += v
+		cur.Numeric++
+	}
+
+	for _, a := range s.Aggregations {
+		if a.Type != Distinct {
+			continue
+		}
+		if _, ok := cur.Distinct[a.Field]; !ok {
+			cur.Distinct[a.Field] = map[string]bool{}
+		}
+		cur.Distinct[a.Field][fields[a.Field](e)] = true
+	}
+
+	return cur, toReturn
+}
+
+//Record builds the output record for a bucket. Min, max and avg are left out if there weren't any numeric values.
+func (s Spec) Record(b Bucket) map[string]interface{} {
+	toReturn := map[string]interface{}{
+		"start-time":  b.Start,
+		"end-time":    s.Interval.End(b.Start),
+		"record-type": s.RecordType,
+	}
+
+	for i, f := range s.GroupBy {
+		if i < len(b.Group) {
+			toReturn[f.As] = b.Group[i]
+		}
+	}
+
+	for _, a := range s.Aggregations {
+		switch a.Type {
+		case Count:
+			toReturn[a.As] = b.Count
+		case Distinct:
+			toReturn[a.As] = len(b.Distinct[a.Field])
+		case Min:
+			if b.Numeric > 0 {
+				toReturn[a.As] = b.Min
+			}
+		case Max:
+			if b.Numeric > 0 {
+				toReturn[a.As] = b.Max
+			}
+		case Avg:
+			if b.Numeric > 0 {
+				toReturn[a.As] = b.Sum / float64(b.Numeric)
+			}
+		}
+	}
+
+	return toReturn
+}
+
+func (c *Caterpillar) send(r map[string]interface{}) {
+	log.L.Debugf("Generating %v record %v", c.spec.RecordType, r)
+
+	c.outChan <- nydus.BulkRecordEntry{
+		Header: nydus.BulkRecordHeader{
+			Index: nydus.HeaderIndex{
+				Index: c.index,
+				Type:  c.rectype,
+			},
+		},
+		Body: r,
+	}
+}
+
+//RegisterGobStructs .
+func (c *Caterpillar) RegisterGobStructs() {
+	c.GobRegisterOnce.Do(func() {
+		gob.Register(map[string]Bucket{})
+		gob.Register(time.Time{})
+	})
+}
+
+//WrapAndSend sends a metrics record as is, the aggregate caterpillar builds its own records.
+func (c *Caterpillar) WrapAndSend(r ci.MetricsRecord) {
+	c.outChan <- nydus.BulkRecordEntry{
+		Header: nydus.BulkRecordHeader{
+			Index: nydus.HeaderIndex{
+				Index: c.index,
+				Type:  c.rectype,
+			},
+		},
+		Body: r,
+	}
+}
@@ -0,0 +1,82 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestAggregate(t *testing.T) {
+	spec, err := GetSpec(map[string]string{
+		"group-by":        "target-device.roomID as room",
+		"bucket-interval": "30m",
+		"aggregations":    "count, distinct(target-device.deviceID) as devices, min, max, avg as average",
+		"record-type":     "room-volume",
+	})
+	if err != nil {
+		t.Fatalf("couldn't get spec: %v", err.Error())
+	}
+
+	location, _ := time.LoadLocation("America/Denver")
+	at := time.Date(2019, 3, 4, 9, 0, 0, 0, location)
+	evs := []events.Event{
+		{Key: "volume", Value: "30", Timestamp: at, TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101"}}},
+		{Key: "volume", Value: "50", Timestamp: at.Add(5 * time.Minute), TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D2", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101"}}},
+		{Key: "volume", Value: "loud", Timestamp: at.Add(10 * time.Minute), TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101"}}},
+	}
+
+	cur := Bucket{}
+	for _, e := range evs {
+		var done *Bucket
+		cur, done = spec.Add(cur, spec.group(e), e)
+		if done != nil {
+			t.Fatalf("unexpected finished bucket")
+		}
+	}
+
+	next := events.Event{Key: "volume", Value: "10", Timestamp: at.Add(40 * time.Minute), TargetDevice: evs[0].TargetDevice}
+	_, done := spec.Add(cur, spec.group(next), next)
+	if done == nil {
+		t.Fatalf("expected the 9:00 bucket to be finished")
+	}
+
+	r := spec.Record(*done)
+	expected := map[string]interface{}{
+		"room":        "ITB-1101",
+		"record-type": "room-volume",
+		"count":       3,
+		"devices":     2,
+		"min":         30.0,
+		"max":         50.0,
+		"average":     40.0,
+	}
+	for k, v := range expected {
+		if r[k] != v {
+			t.Errorf("expected %v to be %v, got %v", k, v, r[k])
+		}
+	}
+
+	//on the day the clocks spring forward the day bucket is 23 hours long, and ends at midnight.
+	spec, _ = GetSpec(map[string]string{"bucket-interval": "24h"})
+	first := events.Event{Key: "volume", Value: "10", Timestamp: time.Date(2019, 3, 10, 12, 0, 0, 0, location)}
+	cur, _ = spec.Add(Bucket{}, spec.group(first), first)
+	next = events.Event{Key: "volume", Value: "10", Timestamp: time.Date(2019, 3, 11, 0, 30, 0, 0, location)}
+	if _, done = spec.Add(cur, spec.group(next), next); done == nil {
+		t.Fatalf("expected the 2019-03-10 bucket to be finished")
+	}
+	if end := spec.Record(*done)["end-time"].(time.Time); !end.Equal(time.Date(2019, 3, 11, 0, 0, 0, 0, location)) {
+		t.Errorf("expected the day bucket to end at midnight, got %v", end)
+	}
+
+	for _, bad := range []map[string]string{
+		{"group-by": "color"},
+		{"aggregations": "median"},
+		{"aggregations": "count, count"},
+		{"bucket-interval": "7h"},
+	} {
+		if _, err := GetSpec(bad); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/byuoitav/caterpillar/caterpillar/timebucket"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//Aggregations
+const (
+	Count    = "count"
+	Distinct = "distinct"
+	Min      = "min"
+	Max      = "max"
+	Avg      = "avg"
+)
+
+//fields are the event fields that can be grouped by or counted distinctly, named as they are in the event json.
+var fields = map[string]func(events.Event) string{
+	"generating-system":        func(e events.Event) string { return e.GeneratingSystem },
+	"key":                      func(e events.Event) string { return e.Key },
+	"value":                    func(e events.Event) string { return e.Value },
+	"user":                     func(e events.Event) string { return e.User },
+	"target-device.deviceID":   func(e events.Event) string { return e.TargetDevice.DeviceID },
+	"target-device.roomID":     func(e events.Event) string { return e.TargetDevice.RoomID },
+	"target-device.buildingID": func(e events.Event) string { return e.TargetDevice.BuildingID },
+	"affected-room.roomID":     func(e events.Event) string { return e.AffectedRoom.RoomID },
+	"affected-room.buildingID": func(e events.Event) string { return e.AffectedRoom.BuildingID },
+}
+
+//Spec is the aggregation described by a caterpillar's type-config.
+type Spec struct {
+	GroupBy      []Field
+	Aggregations []Aggregation
+	Interval     timebucket.Interval
+	Keys         map[string]bool //if set, only events with these keys are aggregated.
+	RecordType   string
+}
+
+//Field is an event field, and the name it's given in the output record.
+type Field struct {
+	Name string
+	As   string
+}
+
+//Aggregation is a single value computed for each bucket. Field is only used by distinct.
+type Aggregation struct {
+	Type  string
+	Field string
+	As    string
+}
+
+//GetSpec builds the spec from the type-config. For example
+//
+//	"group-by": "target-device.roomID as room, key",
+//	"bucket-interval": "1h",
+//	"aggregations": "count, distinct(target-device.deviceID) as devices, avg as average-volume",
+//	"event-keys": "volume",
+//	"record-type": "room-volume"
+//
+//min, max, and avg use the numeric value of the event, events with a value that isn't a number are left out of them.
+func GetSpec(typeConfig map[string]string) (Spec, *nerr.E) {
+	toReturn := Spec{
+		Interval:   timebucket.Hour,
+		Keys:       map[string]bool{},
+		RecordType: "aggregate",
+	}
+
+	for _, v := range splitList(typeConfig["group-by"]) {
+		name, as := splitAs(v)
+		if _, ok := fields[name]; !ok {
+			return toReturn, nerr.Create(fmt.Sprintf("Unkown group-by field %v", name), "invalid-config")
+		}
+		toReturn.GroupBy = append(toReturn.GroupBy, Field{Name: name, As: as})
+	}
+
+	aggs := splitList(typeConfig["aggregations"])
+	if len(aggs) == 0 {
+		aggs = []string{Count}
+	}
+	for _, v := range aggs {
+		a, err := parseAggregation(v)
+		if err != nil {
+			return toReturn, err
+		}
+		toReturn.Aggregations = append(toReturn.Aggregations, a)
+	}
+
+	if v, ok := typeConfig["bucket-interval"]; ok && len(v) > 0 {
+		var err *nerr.E
+		toReturn.Interval, err = timebucket.Parse(v)
+		if err != nil {
+			return toReturn, err
+		}
+	}
+
+	for _, k := range splitList(typeConfig["event-keys"]) {
+		toReturn.Keys[k] = true
+	}
+
+	if v, ok := typeConfig["record-type"]; ok && len(v) > 0 {
+		toReturn.RecordType = v
+	}
+
+	//the names are keys in the output record, so they can't collide.
+	seen := map[string]bool{"start-time": true, "end-time": true, "record-type": true}
+	for _, f := range toReturn.GroupBy {
+		if seen[f.As] {
+			return toReturn, nerr.Create(fmt.Sprintf("Duplicate output field %v", f.As), "invalid-config")
+		}
+		seen[f.As] = true
+	}
+	for _, a := range toReturn.Aggregations {
+		if seen[a.As] {
+			return toReturn, nerr.Create(fmt.Sprintf("Duplicate output field %v", a.As), "invalid-config")
+		}
+		seen[a.As] = true
+	}
+
+	return toReturn, nil
+}
+
+//parseAggregation parses an aggregation like 'avg', 'distinct(user) as users'.
+func parseAggregation(v string) (Aggregation, *nerr.E) {
+	v, as := splitAs(v)
+	toReturn := Aggregation{Type: v, As: as}
+
+	if i := strings.Index(v, "("); i > 0 && strings.HasSuffix(v, ")") {
+		toReturn.Type = v[:i]
+		toReturn.Field = v[i+1 : len(v)-1]
+		if as == v {
+			toReturn.As = fmt.Sprintf("%v-%v", toReturn.Type, toReturn.Field)
+		}
+	}
+
+	switch toReturn.Type {
+	case Count, Min, Max, Avg:
+		if len(toReturn.Field) > 0 {
+			return toReturn, nerr.Create(fmt.Sprintf("Aggregation %v doesn't take a field", toReturn.Type), "invalid-config")
+		}
+	case Distinct:
+		if _, ok := fields[toReturn.Field]; !ok {
+			return toReturn, nerr.Create(fmt.Sprintf("Unkown field %v for distinct", toReturn.Field), "invalid-config")
+		}
+	default:
+		return toReturn, nerr.Create(fmt.Sprintf("Unkown aggregation %v. Must be one of %v, %v(field), %v, %v, or %v", v, Count, Distinct, Min, Max, Avg), "invalid-config")
+	}
+
+	return toReturn, nil
+}
+
+func splitList(v string) []string {
+	toReturn := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			toReturn = append(toReturn, s)
+		}
+	}
+	return toReturn
+}
+
+//splitAs splits 'name as alias'. If there isn't an alias the name is used.
+func splitAs(v string) (string, string) {
+	parts := strings.SplitN(v, " as ", 2)
+	name := strings.TrimSpace(parts[0])
+	if len(parts) == 2 && len(strings.TrimSpace(parts[1])) > 0 {
+		return name, strings.TrimSpace(parts[1])
+	}
+	return name, name
+}
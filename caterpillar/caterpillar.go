@@ -3,9 +3,15 @@ package caterpillar
 import (
 	"fmt"
 
+	"github.com/byuoitav/caterpillar/caterpillar/aggregate"
 	"github.com/byuoitav/caterpillar/caterpillar/catinter"
 	"github.com/byuoitav/caterpillar/caterpillar/corestatetime"
+	"github.com/byuoitav/caterpillar/caterpillar/displayinput"
+	"github.com/byuoitav/caterpillar/caterpillar/errorrate"
+	"github.com/byuoitav/caterpillar/caterpillar/powercount"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
 	"github.com/byuoitav/caterpillar/caterpillar/test"
+	"github.com/byuoitav/caterpillar/config"
 	"github.com/byuoitav/common/nerr"
 )
 
@@ -13,8 +19,16 @@ var caterpillarRegistry map[string]func() (catinter.Caterpillar, *nerr.E)
 
 func init() {
 	caterpillarRegistry = map[string]func() (catinter.Caterpillar, *nerr.E){
-		"joe_test":                test.GetCaterpillar,
-		"core-state-time-machine": corestatetime.GetMachineCaterpillar,
+		"joe_test":                 test.GetCaterpillar,
+		"core-state-time-machine":  corestatetime.GetMachineCaterpillar,
+		"audio-state-time-machine": corestatetime.GetAudioCaterpillar,
+		"power-count":              powercount.GetCaterpillar,
+		"availability-machine":     corestatetime.GetAvailabilityCaterpillar,
+		"room-utilization-machine": corestatetime.GetRoomUtilizationCaterpillar,
+		"input-session-machine":    corestatetime.GetInputSessionCaterpillar,
+		"error-rate":               errorrate.GetCaterpillar,
+		"aggregate":                aggregate.GetCaterpillar,
+		"display-input":            displayinput.GetCaterpillar,
 	}
 }
 
@@ -29,3 +43,46 @@ func GetCaterpillar(cattype string) (catinter.Caterpillar, *nerr.E) {
 	return cat()
 
 }
+
+//ValidateCaterpillar checks that the caterpillar type is known and, for caterpillars built on a state machine, that the machine definition is valid.
+func ValidateCaterpillar(c config.Caterpillar) ([]sm.Problem, *nerr.E) {
+	cat, err := GetCaterpillar(c.Type)
+	if err != nil {
+		return []sm.Problem{}, err.Addf("Couldn't validate caterpillar %v", c.ID)
+	}
+
+	if _, ok := cat.(sm.Definer); !ok {
+		return []sm.Problem{}, nil
+	}
+
+	//an invalid definition is reported through the problems below, anything else (e.g. duplicate machine names) is an error even if some machines were built.
+	machines, err := GetMachines(c, config.State{})
+	if err != nil && (err.Type != "invalid-machine" || len(machines) == 0) {
+		return []sm.Problem{}, err.Addf("Couldn't validate caterpillar %v", c.ID)
+	}
+
+	toReturn := []sm.Problem{}
+	for _, m := range machines {
+		for _, p := range sm.Validate(m.Nodes, m.StartNode) {
+			p.Machine = m.Name
+			toReturn = append(toReturn, p)
+		}
+	}
+
+	return toReturn, nil
+}
+
+//GetMachines builds the state machines used by a caterpillar, loaded with the given state. Returns an error if the caterpillar type isn't built on state machines.
+func GetMachines(c config.Caterpillar, state config.State) ([]*sm.Machine, *nerr.E) {
+	cat, err := GetCaterpillar(c.Type)
+	if err != nil {
+		return []*sm.Machine{}, err.Addf("Couldn't get machines for caterpillar %v", c.ID)
+	}
+
+	d, ok := cat.(sm.Definer)
+	if !ok {
+		return []*sm.Machine{}, nerr.Create(fmt.Sprintf("Caterpillar %v of type %v isn't built on a state machine", c.ID, c.Type), "not-machine")
+	}
+
+	return d.GetMachines(c, state)
+}
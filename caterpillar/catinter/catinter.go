@@ -1,6 +1,8 @@
 package catinter
 
 import (
+	"time"
+
 	"github.com/byuoitav/caterpillar/config"
 	"github.com/byuoitav/caterpillar/nydus"
 	"github.com/byuoitav/common/nerr"
@@ -13,3 +15,23 @@ type Caterpillar interface {
 	RegisterGobStructs()         //It's assumed that you'll initialize gob in this case with the interfaces that Data will be used for state retrieval/storage.
 	WrapAndSend(r MetricsRecord) //It's assumed that you'll initialize gob in this case with the interfaces that Data will be used for state retrieval/storage.
 }
+
+//EventError is an error a caterpillar hit while processing a single event.
+type EventError struct {
+	Time   time.Time `json:"time"` //the event's timestamp.
+	Device string    `json:"device,omitempty"`
+	Key    string    `json:"key,omitempty"`
+	Error  string    `json:"error"`
+}
+
+//EventErrorReporter is implemented by caterpillars that keep track of the errors they hit on individual events, so they can be included in the run's history.
+//It's checked once the run is over.
+type EventErrorReporter interface {
+	EventErrors() []EventError
+}
+
+//Windowed is implemented by caterpillars that need to know the window of events they're being fed, e.g. so state isn't carried past the end of a backfill.
+//It's called before each run.
+type Windowed interface {
+	SetWindow(start, end time.Time)
+}
@@ -10,6 +10,13 @@ const (
 	Volume     = "volume"
 	Mute       = "mute"
 	PowerCount = "power-count"
+	RoomPower  = "room-power"
+
+	Availability = "availability"
+	RoomUse      = "room-use"
+	RoomClassUse = "room-class-use"
+	InputSession = "input-session"
+	ErrorCount   = "error-count"
 )
 
 //MetricsRecord .
@@ -18,6 +25,8 @@ type MetricsRecord struct {
 	EndTime          time.Time `json:"end-time,omitempty"`
 	ElapsedInSeconds int64     `json:"elapsed-in-seconds,omitempty"`
 	RecordType       string    `json:"record-type,omitempty"`
+	ExceptionType    string    `json:"exception-type,omitempty"` //holiday, break, finals, etc. if the record starts on a non-instructional day.
+	Shift            string    `json:"shift,omitempty"`          //the named shift from the slicing type-config the record is in, if any.
 
 	Device   DeviceInfo   `json:"device,omitempty"`
 	Room     RoomInfo     `json:"room,omitempty"`
@@ -33,10 +42,27 @@ type MetricsRecord struct {
 	Muted      *bool  `json:"muted,omitempty"`
 	Power      string `json:"power,omitempty"`
 	PowerCount *int   `json:"power-count,omitempty"`
+	Online     *bool  `json:"online,omitempty"`
+
+	InUse           *bool  `json:"in-use,omitempty"`
+	InUseSeconds    *int64 `json:"in-use-seconds,omitempty"`   //set on room-class-use records, the part of the class the room was in use.
+	ScheduledUnused *bool  `json:"scheduled-unused,omitempty"` //set on room-class-use records, true if the room was never in use during the class.
+
+	Inputs      []string `json:"inputs,omitempty"`       //set on input-session records, each input used during the session.
+	SwitchCount *int     `json:"switch-count,omitempty"` //set on input-session records, the number of times the input was changed during the session.
+
+	ErrorCount  *int           `json:"error-count,omitempty"`
+	TopMessages []MessageCount `json:"top-messages,omitempty"` //set on error-count records, the most common error messages in the bucket.
 
 	Tags []string `json:"tags"`
 }
 
+//MessageCount .
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
 //ClassInfo .
 type ClassInfo struct {
 	DeptName        string  `json:"department,omitempty"`
@@ -0,0 +1,231 @@
+package corestatetime
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//defaultVolumeBandSize is the width of the volume bands if volume-band-size isn't set, e.g. 0-9, 10-19, ... 100
+const defaultVolumeBandSize = 10
+
+//GetAudioCaterpillar is a MachineCaterpillar that tracks mute time and time spent in each volume band by default.
+func GetAudioCaterpillar() (ci.Caterpillar, *nerr.E) {
+	toReturn := &MachineCaterpillar{
+		rectype:         "metrics",
+		devices:         map[string]ci.DeviceInfo{},
+		rooms:           map[string]ci.RoomInfo{},
+		defaultMachines: []string{"mute", "volume"},
+	}
+
+	return toReturn, nil
+}
+
+func getVolumeBandSize(typeConfig map[string]string) (int, *nerr.E) {
+	v, ok := typeConfig["volume-band-size"]
+	if !ok || len(v) == 0 {
+		return defaultVolumeBandSize, nil
+	}
+
+	size, err := strconv.Atoi(v)
+	if err != nil || size < 1 || size > 100 {
+		return 0, nerr.Create(fmt.Sprintf("Invalid volume-band-size %v, must be between 1 and 100", v), "invalid-config")
+	}
+
+	return size, nil
+}
+
+//muteDefinition tracks time muted and unmuted for each device.
+func (c *MachineCaterpillar) muteDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["start"] = sm.Node{
+		ID: "start",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "muted",
+				TriggerValue: "true",
+				Destination:  "muted",
+			},
+			sm.Transition{
+				TriggerKey:   "muted",
+				TriggerValue: "false",
+				Destination:  "unmuted",
+			},
+		},
+	}
+
+	Nodes["muted"] = sm.Node{
+		ID: "muted",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "muted",
+				TriggerValue: "false",
+				Destination:  "unmuted",
+			},
+		},
+		Enter: MuteStore,
+		Exit:  c.BuildMuteRecord,
+	}
+
+	Nodes["unmuted"] = sm.Node{
+		ID: "unmuted",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "muted",
+				TriggerValue: "true",
+				Destination:  "muted",
+			},
+		},
+		Enter: MuteStore,
+		Exit:  c.BuildMuteRecord,
+	}
+
+	return sm.Definition{
+		Name:      "mute",
+		ScopeKey:  "deviceid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
+}
+
+//volumeDefinition tracks the time each device spends in each volume band. Changes within a band don't generate records.
+func (c *MachineCaterpillar) volumeDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["start"] = sm.Node{
+		ID: "start",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:  "volume",
+				Guard:       c.ValidVolume,
+				Destination: "volume",
+			},
+		},
+	}
+
+	Nodes["volume"] = sm.Node{
+		ID: "volume",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				ID:          "band-change",
+				TriggerKey:  "volume",
+				Guard:       c.VolumeBandChanged,
+				Destination: "volume",
+			},
+		},
+		Enter:    c.VolumeStore,
+		Exit:     c.BuildVolumeRecord,
+		Terminal: true,
+	}
+
+	return sm.Definition{
+		Name:      "volume",
+		ScopeKey:  "deviceid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
+}
+
+//MuteStore .
+func MuteStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	if e.Key == "muted" {
+		state["mute-set"] = e.Timestamp
+		state["muted"] = e.Value == "true"
+	}
+	return []ci.MetricsRecord{}, nil
+}
+
+//BuildMuteRecord generates the record for the time spent muted or unmuted.
+func (c *MachineCaterpillar) BuildMuteRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	muted, ok := state["muted"].(bool)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("muted not set to bool", "invalid-state")
+	}
+
+	startTime, ok := state["mute-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("mute-set not set to time.Time", "invalid-state")
+	}
+
+	toReturn := ci.MetricsRecord{
+		Muted:      &False,
+		RecordType: ci.Mute,
+	}
+	if muted {
+		toReturn.Muted = &True
+	}
+
+	return c.AddMetaInfo(startTime, e, toReturn)
+}
+
+//volumeBand returns the lower bound of the band the volume falls in.
+func (c *MachineCaterpillar) volumeBand(value string) (int, bool) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+
+	size := c.volumeBandSize
+	if size < 1 {
+		size = defaultVolumeBandSize
+	}
+
+	return (v / size) * size, true
+}
+
+//ValidVolume is true if the event has a volume we can understand.
+func (c *MachineCaterpillar) ValidVolume(state map[string]interface{}, e events.Event) bool {
+	_, ok := c.volumeBand(e.Value)
+	return ok
+}
+
+//VolumeBandChanged is true if the event moves the device into a different volume band.
+func (c *MachineCaterpillar) VolumeBandChanged(state map[string]interface{}, e events.Event) bool {
+	band, ok := c.volumeBand(e.Value)
+	if !ok {
+		return false
+	}
+
+	cur, ok := state["volume-band"].(int)
+	return !ok || cur != band
+}
+
+//VolumeStore .
+func (c *MachineCaterpillar) VolumeStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	band, ok := c.volumeBand(e.Value)
+	if !ok {
+		return []ci.MetricsRecord{}, nil
+	}
+
+	state["volume-band"] = band
+	state["volume-set"] = e.Timestamp
+	return []ci.MetricsRecord{}, nil
+}
+
+//BuildVolumeRecord generates the record for the time spent in the current volume band.
+func (c *MachineCaterpillar) BuildVolumeRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	band, ok := state["volume-band"].(int)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("volume-band not set to int", "invalid-state")
+	}
+
+	startTime, ok := state["volume-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("volume-set not set to time.Time", "invalid-state")
+	}
+
+	toReturn := ci.MetricsRecord{
+		Volume:     &band,
+		RecordType: ci.Volume,
+	}
+
+	return c.AddMetaInfo(startTime, e, toReturn)
+}
@@ -0,0 +1,36 @@
+package corestatetime
+
+import (
+	"testing"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestVolumeBands(t *testing.T) {
+	size, err := getVolumeBandSize(map[string]string{"volume-band-size": "25"})
+	if err != nil {
+		t.Fatalf("couldn't get band size: %v", err.Error())
+	}
+	mc := &MachineCaterpillar{volumeBandSize: size}
+
+	for v, band := range map[string]int{"0": 0, "24": 0, "25": 25, "99": 75, "100": 100} {
+		if b, ok := mc.volumeBand(v); !ok || b != band {
+			t.Errorf("expected volume %v in band %v, got %v", v, band, b)
+		}
+	}
+	if _, ok := mc.volumeBand("loud"); ok {
+		t.Errorf("expected a non numeric volume to be rejected")
+	}
+
+	state := map[string]interface{}{"volume-band": 25}
+	if mc.VolumeBandChanged(state, events.Event{Key: "volume", Value: "30"}) {
+		t.Errorf("expected a change within the band to be ignored")
+	}
+	if !mc.VolumeBandChanged(state, events.Event{Key: "volume", Value: "50"}) {
+		t.Errorf("expected a change to a new band")
+	}
+
+	if _, err := getVolumeBandSize(map[string]string{"volume-band-size": "0"}); err == nil {
+		t.Errorf("expected an error for a band size of 0")
+	}
+}
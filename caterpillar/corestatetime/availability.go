@@ -0,0 +1,301 @@
+package corestatetime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//defaults for the availability machine
+const (
+	defaultHeartbeatKey      = "heartbeat"
+	defaultHeartbeatInterval = time.Minute
+	defaultMissedHeartbeats  = 3
+)
+
+//GetAvailabilityCaterpillar is a MachineCaterpillar that tracks the time each device is online and offline.
+func GetAvailabilityCaterpillar() (ci.Caterpillar, *nerr.E) {
+	toReturn := &MachineCaterpillar{
+		rectype:         "metrics",
+		devices:         map[string]ci.DeviceInfo{},
+		rooms:           map[string]ci.RoomInfo{},
+		defaultMachines: []string{"availability"},
+	}
+
+	return toReturn, nil
+}
+
+//getHeartbeatConfig reads the heartbeat-key, heartbeat-interval (a duration, e.g. 30s) and missed-heartbeats type-config.
+//A device is considered offline once it has gone missed-heartbeats intervals without a heartbeat.
+func getHeartbeatConfig(typeConfig map[string]string) (string, time.Duration, *nerr.E) {
+	key := defaultHeartbeatKey
+	if v, ok := typeConfig["heartbeat-key"]; ok && len(v) > 0 {
+		key = v
+	}
+
+	interval := defaultHeartbeatInterval
+	if v, ok := typeConfig["heartbeat-interval"]; ok && len(v) > 0 {
+		var err error
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return "", 0, nerr.Create(fmt.Sprintf("Invalid heartbeat-interval %v, must be a positive duration", v), "invalid-config")
+		}
+	}
+
+	missed := defaultMissedHeartbeats
+	if v, ok := typeConfig["missed-heartbeats"]; ok && len(v) > 0 {
+		var err error
+		missed, err = strconv.Atoi(v)
+		if err != nil || missed < 1 {
+			return "", 0, nerr.Create(fmt.Sprintf("Invalid missed-heartbeats %v, must be at least 1", v), "invalid-config")
+		}
+	}
+
+	return key, interval * time.Duration(missed), nil
+}
+
+//availabilityDefinition tracks online and offline time for each device. Devices are online while heartbeats keep coming in, and
+//offline after an explicit online=Offline event or once heartbeats have been missed for long enough.
+//A gap in heartbeats is recorded as offline time when the next heartbeat arrives, or at the end of the run if it hasn't by then.
+//Offline time is recorded up to the end of each run, so devices that are still offline show up without waiting for them to come back.
+func (c *MachineCaterpillar) availabilityDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["start"] = sm.Node{
+		ID: "start",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:  c.heartbeatKey,
+				Destination: "online",
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       IsOnlineEvent,
+				Destination: "online",
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       IsOfflineEvent,
+				Destination: "offline",
+			},
+		},
+	}
+
+	Nodes["online"] = sm.Node{
+		ID: "online",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				ID:          "missed-heartbeats",
+				TriggerKey:  c.heartbeatKey,
+				Guard:       c.HeartbeatsMissed,
+				Destination: "online",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					c.BuildMissedRecord,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  c.heartbeatKey,
+				Destination: "online",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SeenStore,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       IsOfflineEvent,
+				Destination: "offline",
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       c.OnlineAfterMissed,
+				Destination: "online",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					c.BuildMissedRecord,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       IsOnlineEvent,
+				Destination: "online",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SeenStore,
+				},
+			},
+			sm.Transition{
+				ID:          "run-end-missed-heartbeats",
+				TriggerKey:  sm.RunEndEventKey,
+				Guard:       c.HeartbeatsMissed,
+				Destination: "offline",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					c.BuildOutageRecord,
+				},
+			},
+		},
+		Enter: OnlineEnter,
+		Exit:  c.BuildOnlineRecord,
+	}
+
+	Nodes["offline"] = sm.Node{
+		ID: "offline",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:  c.heartbeatKey,
+				Destination: "online",
+			},
+			sm.Transition{
+				TriggerKey:  "online",
+				Guard:       IsOnlineEvent,
+				Destination: "online",
+			},
+			sm.Transition{
+				TriggerKey:  sm.RunEndEventKey,
+				Destination: "offline",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					c.CheckpointOffline,
+				},
+			},
+		},
+		Enter: c.OfflineEnter,
+		Exit:  c.BuildOfflineRecord,
+	}
+
+	return sm.Definition{
+		Name:      "availability",
+		ScopeKey:  "deviceid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
+}
+
+//IsOnlineEvent .
+func IsOnlineEvent(state map[string]interface{}, e events.Event) bool {
+	return strings.EqualFold(e.Value, "online")
+}
+
+//IsOfflineEvent .
+func IsOfflineEvent(state map[string]interface{}, e events.Event) bool {
+	return strings.EqualFold(e.Value, "offline")
+}
+
+//HeartbeatsMissed is true if the device went long enough without a heartbeat before this event to be considered offline.
+func (c *MachineCaterpillar) HeartbeatsMissed(state map[string]interface{}, e events.Event) bool {
+	_, missed := c.offlineAt(state, e)
+	return missed
+}
+
+//OnlineAfterMissed is true for an online=Online event that comes after missed heartbeats.
+func (c *MachineCaterpillar) OnlineAfterMissed(state map[string]interface{}, e events.Event) bool {
+	return IsOnlineEvent(state, e) && c.HeartbeatsMissed(state, e)
+}
+
+//offlineAt returns when the device stopped being online, at the latest the time of e. The bool is true if that was because of missed heartbeats.
+func (c *MachineCaterpillar) offlineAt(state map[string]interface{}, e events.Event) (time.Time, bool) {
+	seen, ok := state["last-seen"].(time.Time)
+	if !ok || c.offlineAfter <= 0 {
+		return e.Timestamp, false
+	}
+
+	if cutoff := seen.Add(c.offlineAfter); cutoff.Before(e.Timestamp) {
+		return cutoff, true
+	}
+	return e.Timestamp, false
+}
+
+//SeenStore .
+func SeenStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["last-seen"] = e.Timestamp
+	return []ci.MetricsRecord{}, nil
+}
+
+//OnlineEnter .
+func OnlineEnter(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["online-set"] = e.Timestamp
+	state["last-seen"] = e.Timestamp
+	return []ci.MetricsRecord{}, nil
+}
+
+//OfflineEnter starts the offline time when the device stopped being online, which is earlier than this event if heartbeats were missed before it.
+func (c *MachineCaterpillar) OfflineEnter(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["offline-set"], _ = c.offlineAt(state, e)
+	delete(state, "last-seen")
+	return []ci.MetricsRecord{}, nil
+}
+
+//BuildOnlineRecord generates the record for the time online, up until the device was last heard from (plus the allowed gap).
+func (c *MachineCaterpillar) BuildOnlineRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	startTime, ok := state["online-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("online-set not set to time.Time", "invalid-state")
+	}
+
+	end, _ := c.offlineAt(state, e)
+	return c.buildAvailabilityRecord(true, startTime, end, e)
+}
+
+//BuildMissedRecord generates the offline record for a gap in heartbeats.
+func (c *MachineCaterpillar) BuildMissedRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	startTime, missed := c.offlineAt(state, e)
+	if !missed {
+		return []ci.MetricsRecord{}, nil
+	}
+
+	return c.buildAvailabilityRecord(false, startTime, e.Timestamp, e)
+}
+
+//BuildOutageRecord generates the offline record for a gap in heartbeats that's still going at the end of a run.
+//last-seen is cleared once it's recorded, so the offline time from here on starts at this event.
+func (c *MachineCaterpillar) BuildOutageRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	records, err := c.BuildMissedRecord(state, e)
+	delete(state, "last-seen")
+	return records, err
+}
+
+//CheckpointOffline generates the record for the time offline so far, and starts the offline time over at this event.
+func (c *MachineCaterpillar) CheckpointOffline(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	records, err := c.BuildOfflineRecord(state, e)
+	if err != nil {
+		return records, err
+	}
+
+	state["offline-set"] = e.Timestamp
+	return records, nil
+}
+
+//BuildOfflineRecord .
+func (c *MachineCaterpillar) BuildOfflineRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	startTime, ok := state["offline-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("offline-set not set to time.Time", "invalid-state")
+	}
+
+	return c.buildAvailabilityRecord(false, startTime, e.Timestamp, e)
+}
+
+func (c *MachineCaterpillar) buildAvailabilityRecord(online bool, start, end time.Time, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	if !start.Before(end) {
+		return []ci.MetricsRecord{}, nil
+	}
+
+	toReturn := ci.MetricsRecord{
+		Online:     &False,
+		RecordType: ci.Availability,
+		Building:   ci.BuildingInfo{ID: e.TargetDevice.BuildingID},
+	}
+	if online {
+		toReturn.Online = &True
+	}
+
+	//AddMetaInfo ends the record at the event time.
+	e.Timestamp = end
+	return c.AddMetaInfo(start, e, toReturn)
+}
@@ -0,0 +1,93 @@
+package corestatetime
+
+import (
+	"testing"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/nydus"
+	"github.com/byuoitav/caterpillar/v2/schedule"
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestOfflineAt(t *testing.T) {
+	key, after, err := getHeartbeatConfig(map[string]string{"heartbeat-interval": "30s", "missed-heartbeats": "4"})
+	if err != nil {
+		t.Fatalf("couldn't get heartbeat config: %v", err.Error())
+	}
+	if key != defaultHeartbeatKey || after != 2*time.Minute {
+		t.Fatalf("expected %v after 2m, got %v after %v", defaultHeartbeatKey, key, after)
+	}
+
+	mc := &MachineCaterpillar{heartbeatKey: key, offlineAfter: after}
+	seen := time.Date(2019, 3, 4, 8, 0, 0, 0, location)
+	state := map[string]interface{}{"last-seen": seen}
+
+	e := events.Event{Key: key, Timestamp: seen.Add(90 * time.Second)}
+	if at, missed := mc.offlineAt(state, e); missed || !at.Equal(e.Timestamp) {
+		t.Errorf("expected a heartbeat inside the window to keep the device online")
+	}
+
+	e.Timestamp = seen.Add(10 * time.Minute)
+	if at, missed := mc.offlineAt(state, e); !missed || !at.Equal(seen.Add(after)) {
+		t.Errorf("expected the device to go offline at %v, got %v", seen.Add(after), at)
+	}
+
+	if _, _, err := getHeartbeatConfig(map[string]string{"missed-heartbeats": "0"}); err == nil {
+		t.Errorf("expected an error for 0 missed heartbeats")
+	}
+}
+
+func TestOutageClosedAtRunEnd(t *testing.T) {
+	out := make(chan nydus.BulkRecordEntry, 10)
+	mc := &MachineCaterpillar{
+		outChan:      out,
+		devices:      map[string]ci.DeviceInfo{"ITB-1101-D1": ci.DeviceInfo{ID: "ITB-1101-D1"}},
+		rooms:        map[string]ci.RoomInfo{"ITB-1101": ci.RoomInfo{ID: "ITB-1101"}},
+		schedules:    schedule.NewStatic(nil),
+		heartbeatKey: defaultHeartbeatKey,
+		offlineAfter: 3 * time.Minute,
+	}
+
+	machines, err := sm.BuildStateMachines([]sm.Definition{mc.availabilityDefinition()}, config.State{}, mc)
+	if err != nil {
+		t.Fatalf("couldn't build machine: %v", err.Error())
+	}
+	m := machines[0]
+
+	start := time.Date(2019, 3, 4, 8, 0, 0, 0, location)
+	heartbeat := func(at time.Time) {
+		e := events.Event{Key: defaultHeartbeatKey, Timestamp: at, TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101"}}}
+		if err := m.ProcessEvent(e); err != nil {
+			t.Fatalf("couldn't process event: %v", err.Error())
+		}
+	}
+	online := func() map[bool]time.Duration {
+		toReturn := map[bool]time.Duration{}
+		for len(out) > 0 {
+			r := (<-out).Body.(ci.MetricsRecord)
+			toReturn[*r.Online] += r.EndTime.Sub(r.StartTime)
+		}
+		return toReturn
+	}
+
+	//the device goes dark after its second heartbeat, the run ends half an hour in
+	heartbeat(start)
+	heartbeat(start.Add(time.Minute))
+	m.EndRun(start.Add(30 * time.Minute))
+
+	if got := online(); got[true] != 4*time.Minute || got[false] != 26*time.Minute {
+		t.Fatalf("expected 4m online and 26m offline by the end of the run, got %v online and %v offline", got[true], got[false])
+	}
+	if last := m.CurStates["ITB-1101-D1"].LastEvent; !last.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected the end of the run not to count as an event, last event at %v", last)
+	}
+
+	//the next run only records the outage from where the last one left off
+	heartbeat(start.Add(time.Hour))
+	if got := online(); got[true] != 0 || got[false] != 30*time.Minute {
+		t.Errorf("expected 30m more offline when the device came back, got %v online and %v offline", got[true], got[false])
+	}
+}
@@ -10,25 +10,38 @@ import (
 	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
 	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
 	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/caterpillar/nydus"
-	"github.com/byuoitav/common/db"
+	"github.com/byuoitav/caterpillar/v2/calendar"
+	"github.com/byuoitav/caterpillar/v2/inventory"
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/caterpillar/v2/schedule"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
 	"github.com/byuoitav/common/v2/events"
-	"github.com/byuoitav/wso2services/classschedules/registar"
 )
 
 //MachineCaterpillar .
 type MachineCaterpillar struct {
-	Machine *sm.Machine
-	outChan chan nydus.BulkRecordEntry
-	state   config.State
-
-	rectype string
-	devices map[string]ci.DeviceInfo
-	rooms   map[string]ci.RoomInfo
-
-	index string
+	Machines []*sm.Machine
+	outChan  chan nydus.BulkRecordEntry
+	state    config.State
+
+	rectype   string
+	devices   map[string]ci.DeviceInfo //from the inventory type-config, see inventory.ProviderFor. defaults to couch.
+	rooms     map[string]ci.RoomInfo
+	calendar  *calendar.Calendar //from the calendar type-config, see calendar.ProviderFor. used to tag records on holidays, breaks, etc.
+	schedules schedule.Provider  //from the class-schedule type-config, see schedule.ProviderFor. defaults to the registar.
+
+	defaultMachines []string //machines to run if the machines type-config isn't set.
+	volumeBandSize  int
+	heartbeatKey    string
+	offlineAfter    time.Duration   //how long without a heartbeat before a device is considered offline.
+	sessionGap      time.Duration   //how long without activity before an input session is over.
+	slicer          schedule.Slicer //how records are split, from the slicing type-config.
+
+	index       string
+	eventErrors []ci.EventError //errors processing events this run, see EventErrors.
 
 	GobRegisterOnce sync.Once
 }
@@ -53,20 +66,20 @@ func init() {
 func GetMachineCaterpillar() (ci.Caterpillar, *nerr.E) {
 
 	toReturn := &MachineCaterpillar{
-		rectype: "metrics",
-		devices: map[string]ci.DeviceInfo{},
-		rooms:   map[string]ci.RoomInfo{},
-	}
-
-	var err *nerr.E
-	toReturn.devices, toReturn.rooms, err = GetDeviceAndRoomInfo()
-	if err != nil {
-		return toReturn, err.Addf("Couldn't initialize corestatetime caterpillar.")
+		rectype:         "metrics",
+		devices:         map[string]ci.DeviceInfo{},
+		rooms:           map[string]ci.RoomInfo{},
+		defaultMachines: []string{"device-state"},
 	}
 
 	return toReturn, nil
 }
 
+//GetMachines fulfills the statemachine.Definer interface.
+func (c *MachineCaterpillar) GetMachines(cnfg config.Caterpillar, state config.State) ([]*sm.Machine, *nerr.E) {
+	return c.buildStateMachines(cnfg, state)
+}
+
 //Run .
 func (c *MachineCaterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, cnfg config.Caterpillar, GetData func(int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
 
@@ -78,14 +91,51 @@ func (c *MachineCaterpillar) Run(id string, recordCount int, state config.State,
 	c.index = index
 	c.state = state
 	c.outChan = outChan
-	var err *nerr.E
+	c.eventErrors = nil
 
-	c.Machine, err = c.buildStateMachine()
+	var er error
+	expiry, err := sm.GetExpiry(cnfg.TypeConfig)
+	if err != nil {
+		return state, err.Addf("Couldn't run machinecaterepillar")
+	}
+
+	//we wait until we're actually going to run to pull the device and room info, so the caterpillar can be built for validation without the database.
+	c.devices, c.rooms, err = GetDeviceAndRoomInfo(cnfg.TypeConfig["inventory"])
+	if err != nil {
+		return state, err.Addf("Couldn't initialize corestatetime caterpillar.")
+	}
+
+	//a calendar from sql uses the same sql type-config as the display input caterpillar.
+	c.calendar, er = calendar.Load(cnfg.TypeConfig["calendar"], metricssql.Config{
+		Driver:           strings.TrimSpace(cnfg.TypeConfig["sql-driver"]),
+		ConnectionString: strings.TrimSpace(cnfg.TypeConfig["sql-connection-string"]),
+		Schema:           strings.TrimSpace(cnfg.TypeConfig["schema"]),
+	})
+	if er != nil {
+		return state, nerr.Translate(er).Addf("Couldn't initialize corestatetime caterpillar.")
+	}
+
+	source := "registar"
+	if v, ok := cnfg.TypeConfig["class-schedule"]; ok && len(strings.TrimSpace(v)) > 0 {
+		source = strings.TrimSpace(v)
+	}
+	c.schedules, er = schedule.Get(source)
+	if er != nil {
+		return state, nerr.Translate(er).Addf("Couldn't initialize corestatetime caterpillar.")
+	}
+
+	c.Machines, err = c.buildStateMachines(cnfg, state)
 
 	if err != nil {
 		return state, err.Addf("Couldn't run machinecaterepillar")
 	}
 
+	for _, m := range c.Machines {
+		m.OnTransition = func(machine, from, to string) {
+			metrics.MachineTransitions.WithLabelValues(id, machine, from, to).Inc()
+		}
+	}
+
 	inchan, err := GetData(1000)
 	if err != nil {
 		return state, err.Addf("Couldn't run machinecaterepillar")
@@ -97,9 +147,23 @@ func (c *MachineCaterpillar) Run(id string, recordCount int, state config.State,
 		if e, ok := i.(events.Event); ok {
 			count++
 			log.L.Debugf("Processing event %v", count)
-			err = c.Machine.ProcessEvent(e)
-			if err != nil {
-				log.L.Errorf("Error procssing event: %v", err.Error())
+
+			//every machine sees every event, an error in one doesn't stop the others.
+			failed := false
+			for _, m := range c.Machines {
+				err = m.ProcessEvent(e)
+				if err != nil {
+					log.L.Errorf("Error procssing event in machine %v: %v", m.Name, err.Error())
+					c.eventErrors = append(c.eventErrors, ci.EventError{
+						Time:   e.Timestamp,
+						Device: e.TargetDevice.DeviceID,
+						Key:    e.Key,
+						Error:  fmt.Sprintf("%v: %v", m.Name, err.Error()),
+					})
+					failed = true
+				}
+			}
+			if failed {
 				continue
 			}
 			lastTime = e.Timestamp
@@ -109,20 +173,104 @@ func (c *MachineCaterpillar) Run(id string, recordCount int, state config.State,
 		log.L.Debugf("Waiting for next event..")
 	}
 
-	//build our state machine
-	d := map[string]sm.MachineState{}
-
-	for k, v := range c.Machine.CurStates {
-		d[k] = *v
+	//end the run and expire relative to the events we've seen rather than the clock, so backfills don't throw away states they just built.
+	for _, m := range c.Machines {
+		m.EndRun(lastTime)
+		m.Expire(expiry, lastTime, c.inInventory(m.ScopeKey))
 	}
 
 	return config.State{
 		LastEventTime: lastTime,
-		Data:          d,
+		Data:          sm.GetMachineStates(c.Machines),
 	}, nil
 }
 
-func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
+//inInventory checks scopes against the device and room lists, so states for things that have been deleted are pruned.
+//Returns nil (keep everything) if there's no list for the scope, or the list is empty.
+func (c *MachineCaterpillar) inInventory(scopeKey string) func(string) bool {
+	switch scopeKey {
+	case "deviceid":
+		if len(c.devices) == 0 {
+			return nil
+		}
+		return func(k string) bool {
+			_, ok := c.devices[k]
+			return ok
+		}
+	case "roomid":
+		if len(c.rooms) == 0 {
+			return nil
+		}
+		return func(k string) bool {
+			_, ok := c.rooms[k]
+			return ok
+		}
+	}
+
+	return nil
+}
+
+//machineDefinitions maps the names that can be used in the machines type-config to the machines they build.
+func (c *MachineCaterpillar) machineDefinitions() map[string]func() sm.Definition {
+	return map[string]func() sm.Definition{
+		"device-state":  c.deviceStateDefinition,
+		"room-power":    c.roomPowerDefinition,
+		"mute":          c.muteDefinition,
+		"volume":        c.volumeDefinition,
+		"availability":  c.availabilityDefinition,
+		"room-use":      c.roomUseDefinition,
+		"input-session": c.inputSessionDefinition,
+	}
+}
+
+//buildStateMachines builds the machines listed (comma separated) in the machines type-config. If none are listed the caterpillar type's default machines are run.
+func (c *MachineCaterpillar) buildStateMachines(cnfg config.Caterpillar, state config.State) ([]*sm.Machine, *nerr.E) {
+	names := c.defaultMachines
+	if len(names) == 0 {
+		names = []string{"device-state"}
+	}
+	if v, ok := cnfg.TypeConfig["machines"]; ok && len(strings.TrimSpace(v)) > 0 {
+		names = strings.Split(v, ",")
+	}
+
+	var err *nerr.E
+	c.volumeBandSize, err = getVolumeBandSize(cnfg.TypeConfig)
+	if err != nil {
+		return []*sm.Machine{}, err.Addf("Couldn't build machines for caterpillar %v", cnfg.ID)
+	}
+
+	c.heartbeatKey, c.offlineAfter, err = getHeartbeatConfig(cnfg.TypeConfig)
+	if err != nil {
+		return []*sm.Machine{}, err.Addf("Couldn't build machines for caterpillar %v", cnfg.ID)
+	}
+
+	c.sessionGap, err = getSessionGap(cnfg.TypeConfig)
+	if err != nil {
+		return []*sm.Machine{}, err.Addf("Couldn't build machines for caterpillar %v", cnfg.ID)
+	}
+
+	c.slicer, err = getSlicer(cnfg.TypeConfig)
+	if err != nil {
+		return []*sm.Machine{}, err.Addf("Couldn't build machines for caterpillar %v", cnfg.ID)
+	}
+
+	available := c.machineDefinitions()
+	defs := []sm.Definition{}
+
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		def, ok := available[n]
+		if !ok {
+			return []*sm.Machine{}, nerr.Create(fmt.Sprintf("Unkown machine %v for caterpillar %v", n, cnfg.ID), "invalid-config")
+		}
+		defs = append(defs, def())
+	}
+
+	return sm.BuildStateMachines(defs, state, c)
+}
+
+//deviceStateDefinition tracks power, blank and input time for each device.
+func (c *MachineCaterpillar) deviceStateDefinition() sm.Definition {
 
 	Nodes := map[string]sm.Node{}
 	//definitions of our state machine.
@@ -138,8 +286,23 @@ func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
 		},
 	}
 
+	//powered owns the power off handling for all of the states where the display is on.
+	//Leaving it closes out the unblanked time; if we're leaving from blank, the blank exit has already reset blank-set so there's nothing to record.
+	Nodes["powered"] = sm.Node{
+		ID: "powered",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "standby",
+				Destination:  "powerstandby",
+			},
+		},
+		Exit: c.BuildUnblankedRecord,
+	}
+
 	Nodes["poweron"] = sm.Node{
-		ID: "poweron",
+		ID:     "poweron",
+		Parent: "powered",
 		Transitions: []sm.Transition{
 			sm.Transition{
 				TriggerKey:  "input",
@@ -150,21 +313,14 @@ func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
 				TriggerValue: "true",
 				Destination:  "blank",
 			},
-			sm.Transition{
-				TriggerKey:   "power",
-				TriggerValue: "standby",
-				Destination:  "powerstandby",
-				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
-					c.BuildUnblankedRecord,
-				},
-			},
 		},
 		Enter: PowerOnStore,
 		Exit:  c.BuildInputRecord,
 	}
 
 	Nodes["inputactive"] = sm.Node{
-		ID: "inputactive",
+		ID:     "inputactive",
+		Parent: "powered",
 		Transitions: []sm.Transition{
 			sm.Transition{
 				TriggerKey:  "input",
@@ -175,21 +331,14 @@ func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
 				TriggerValue: "true",
 				Destination:  "blank",
 			},
-			sm.Transition{
-				TriggerKey:   "power",
-				TriggerValue: "standby",
-				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
-					c.BuildUnblankedRecord,
-				},
-				Destination: "powerstandby",
-			},
 		},
 		Exit:  c.BuildInputRecord,
 		Enter: InputStore,
 	}
 
 	Nodes["blank"] = sm.Node{
-		ID: "blank",
+		ID:     "blank",
+		Parent: "powered",
 		Transitions: []sm.Transition{
 			sm.Transition{
 				TriggerKey:  "input",
@@ -204,11 +353,6 @@ func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
 				TriggerValue: "false",
 				Destination:  "inputactive",
 			},
-			sm.Transition{
-				TriggerKey:   "power",
-				TriggerValue: "standby",
-				Destination:  "powerstandby",
-			},
 		},
 		Enter: c.EnterBlank,
 		Exit:  c.BuildBlankedRecord,
@@ -235,7 +379,12 @@ func (c *MachineCaterpillar) buildStateMachine() (*sm.Machine, *nerr.E) {
 		Exit:  c.StandbyExit,
 	}
 
-	return sm.BuildStateMachine("deviceid", Nodes, "start", c.state, c)
+	return sm.Definition{
+		Name:      "device-state",
+		ScopeKey:  "deviceid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
 }
 
 //StandbyEnter .
@@ -311,6 +460,11 @@ func (c *MachineCaterpillar) BuildUnblankedRecord(state map[string]interface{},
 		return []ci.MetricsRecord{}, nerr.Create("blank-set not set to time.Time", "invalid-state")
 	}
 
+	//nothing to record, e.g. blank-set was just reset on the way out of blank.
+	if !startTime.Before(e.Timestamp) {
+		return []ci.MetricsRecord{}, nil
+	}
+
 	return c.AddMetaInfo(startTime, e, toReturn)
 }
 
@@ -411,7 +565,16 @@ func PowerOnStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRec
 
 //AddMetaInfo .
 func (c *MachineCaterpillar) AddMetaInfo(startTime time.Time, e events.Event, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
+	r, err := c.addDeviceInfo(e, r)
+	if err != nil {
+		return []ci.MetricsRecord{r}, err
+	}
+
+	return sliceRecord(c.schedules, c.slicer, startTime, e.Timestamp, r)
+}
 
+//addDeviceInfo fills out the device and room info for the event's target device.
+func (c *MachineCaterpillar) addDeviceInfo(e events.Event, r ci.MetricsRecord) (ci.MetricsRecord, *nerr.E) {
 	r.Device = ci.DeviceInfo{ID: e.TargetDevice.DeviceID}
 	r.Room = ci.RoomInfo{ID: e.TargetDevice.RoomID}
 
@@ -430,7 +593,7 @@ func (c *MachineCaterpillar) AddMetaInfo(startTime time.Time, e events.Event, r
 	} else {
 		err := nerr.Create(fmt.Sprintf("unkown device %v", r.Device.ID), "invalid-device")
 		log.L.Errorf("%v", err.Error())
-		return []ci.MetricsRecord{r}, err
+		return r, err
 	}
 
 	if room, ok := c.rooms[r.Room.ID]; ok {
@@ -438,143 +601,93 @@ func (c *MachineCaterpillar) AddMetaInfo(startTime time.Time, e events.Event, r
 	} else {
 		err := nerr.Create(fmt.Sprintf("unkown room %v", r.Device.ID), "invalid-room")
 		log.L.Errorf("%v", err.Error())
-		return []ci.MetricsRecord{r}, err
+		return r, err
 	}
 
-	records, err := AddClassTimes(startTime, e.Timestamp, r)
-	if err != nil {
-		return records, err
-	}
+	return r, nil
+}
 
-	newRecords := []ci.MetricsRecord{}
+//AddRoomMetaInfo is AddMetaInfo for records that describe a whole room rather than a single device.
+func (c *MachineCaterpillar) AddRoomMetaInfo(startTime time.Time, e events.Event, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
+	return c.addRoomMetaInfo(c.slicer, startTime, e, r)
+}
 
-	//otherwise we check for records that cross over midnight
-	for _, cur := range records {
-		log.L.Debugf("Checking for multi-day transition of %v - %v", cur.StartTime.In(location), cur.EndTime.In(location))
+func (c *MachineCaterpillar) addRoomMetaInfo(slicer schedule.Slicer, startTime time.Time, e events.Event, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
+	r.Room = ci.RoomInfo{ID: e.TargetDevice.RoomID}
 
-		for cur.EndTime.In(location).After(endOfDay(cur.StartTime.In(location))) {
-			log.L.Debugf("Record splits over midnight %v - %v", cur.StartTime.In(location), cur.EndTime.In(location))
-			//we need to split at midnight
-			second := cur
-			//reset the time elapsed
-			cur.EndTime = endOfDay(cur.StartTime.In(location))
-			cur.ElapsedInSeconds = int64((cur.EndTime.Sub(cur.StartTime)) / time.Second)
+	if room, ok := c.rooms[r.Room.ID]; ok {
+		r.Room = room
+	} else {
+		err := nerr.Create(fmt.Sprintf("unkown room %v", r.Room.ID), "invalid-room")
+		log.L.Errorf("%v", err.Error())
+		return []ci.MetricsRecord{r}, err
+	}
 
-			log.L.Debugf("Adding record %v-%v", cur.StartTime.In(location), cur.EndTime.In(location))
-			newRecords = append(newRecords, cur)
+	return sliceRecord(c.schedules, slicer, startTime, e.Timestamp, r)
+}
 
-			log.L.Debugf("Changing date from %v to %v", second.StartTime.In(location), second.StartTime.AddDate(0, 0, 1).In(location))
-			//get start time of the day after the current start time
-			second.StartTime = startOfDay(second.StartTime.AddDate(0, 0, 1).In(location))
-			second.ElapsedInSeconds = int64((second.EndTime.Sub(second.StartTime)) / time.Second)
+//defaultSlicing is how records are split if the slicing type-config isn't set.
+const defaultSlicing = "class,midnight"
 
-			cur = second
-			log.L.Debugf("Left over record: %v-%v", second.StartTime.In(location), second.EndTime.In(location))
-		}
+//getSlicer reads the slicing type-config, see schedule.ParseSlicer for the rules.
+func getSlicer(typeConfig map[string]string) (schedule.Slicer, *nerr.E) {
+	v := strings.TrimSpace(typeConfig["slicing"])
+	if len(v) == 0 {
+		v = defaultSlicing
+	}
 
-		newRecords = append(newRecords, cur)
+	slicer, err := schedule.ParseSlicer(v)
+	if err != nil {
+		return slicer, nerr.Create(fmt.Sprintf("Invalid slicing %v: %v", v, err.Error()), "invalid-config")
 	}
-	return newRecords, nil
+
+	return slicer, nil
+}
+
+//EventErrors fulfills the catinter.EventErrorReporter interface.
+func (c *MachineCaterpillar) EventErrors() []ci.EventError {
+	return c.eventErrors
 }
 
 //RegisterGobStructs .
 func (c *MachineCaterpillar) RegisterGobStructs() {
 	c.GobRegisterOnce.Do(func() {
 		gob.Register(map[string]sm.MachineState{})
+		gob.Register(sm.MachineStates{})
+		gob.Register(map[string]bool{})
+		gob.Register(map[string]DisplayStatus{})
+		gob.Register(ClassUse{})
 		gob.Register(time.Time{})
 	})
 }
 
-//AddClassTimes .
-func AddClassTimes(start, end time.Time, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
-	log.L.Debugf("Adding class times for %v", r.Room.ID)
+//AddClassTimes splits r into a record for each class in its room from start to end, and the gaps between them.
+//Sections that meet at the same time (e.g. cross-listed courses) share a record with their info combined, see schedule.Composite.
+func AddClassTimes(provider schedule.Provider, start, end time.Time, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
+	return sliceRecord(provider, schedule.Slicer{Classes: true}, start, end, r)
+}
 
-	//we split the record into multiple recors, each with the class info filled out for that class.
-	schedules, err := registar.GetClassScheduleForTimeBlock(r.Room.ID, start, end)
-	if err != nil {
-		return []ci.MetricsRecord{}, err.Addf("Couldn't add class info to event")
-	}
-	log.L.Debugf("Got the schedules.")
+//sliceRecord splits r from start to end into a record for each slice from slicer, with the class info for the classes meeting in it.
+func sliceRecord(provider schedule.Provider, slicer schedule.Slicer, start, end time.Time, r ci.MetricsRecord) ([]ci.MetricsRecord, *nerr.E) {
+	log.L.Debugf("Adding class times to event-type %+v in %v. StartTime %v, end Time %v", r.RecordType, r.Room.ID, start.In(location), end.In(location))
 
-	loc, er := time.LoadLocation("America/Denver")
+	classes, er := schedule.Classes(provider, r.Room.ID, start, end)
 	if er != nil {
-		log.L.Errorf("Couldn't load America/Denver time zone: %v", er.Error())
-		return []ci.MetricsRecord{}, nerr.Translate(er)
+		return []ci.MetricsRecord{}, nerr.Translate(er).Addf("Couldn't add class info to event")
 	}
 
-	adjust := 0 * time.Hour //hours to add
-
-	//we need to check if the times in questions are daylight savings or not... things are read in the -7 time zone, so we're moving to the -6
-	_, offset := start.In(loc).Zone()
-	if offset == -6*60*60 {
-		adjust = 1 * time.Hour
-	}
-
-	log.L.Debugf("Adding class times to event-type %+v. StartTime %v, end Time %v", r.RecordType, start.In(time.Local), end.In(time.Local))
-
 	toReturn := []ci.MetricsRecord{}
-
-	lastClassEnd := start
-	//we need to go through add class info
-	for _, v := range schedules {
-		v.StartTime.Add(adjust)
-		v.EndTime.Add(adjust)
-		//check to see if it's a duplicate
-
-		if v.StartTime.Before(lastClassEnd) {
-			log.L.Debugf("Overlapping class, skipping.")
-			continue
-		}
-
-		curInfo := ci.ClassInfo{
-			DeptName:        v.DeptName,
-			CatalogNumber:   v.CatalogNumber,
-			ClassName:       fmt.Sprintf("%v-%v", v.DeptName, v.CatalogNumber),
-			CreditHours:     v.CreditHours,
-			ClassSize:       v.SectionSize,
-			ClassEnrollment: v.TotalEnr,
-			Instructor:      v.InstructorName,
-
-			ClassStart: v.StartTime,
-			ClassEnd:   v.EndTime,
-		}
-
-		if lastClassEnd.Before(v.StartTime) {
-			//I need to generate one for the time from last class end to v.StartTime
-
-			tmp := r
-			tmp.StartTime = lastClassEnd
-			tmp.EndTime = v.StartTime
-			tmp.ElapsedInSeconds = int64((tmp.EndTime.Sub(tmp.StartTime)) / time.Second)
-
-			log.L.Debugf("Adding front-padded time block %v %v ", tmp.StartTime.In(time.Local), tmp.EndTime.In(time.Local))
-			toReturn = append(toReturn, tmp)
-		}
-
-		//now we need to figure out the end time
-		tmpend := v.EndTime
-		if tmpend.After(end) {
-			tmpend = end
-		}
-
+	for _, slice := range slicer.Slice(start, end, classes) {
 		tmp := r
-		tmp.StartTime = v.StartTime
-		tmp.EndTime = tmpend
+		tmp.StartTime = slice.Start
+		tmp.EndTime = slice.End
 		tmp.ElapsedInSeconds = int64((tmp.EndTime.Sub(tmp.StartTime)) / time.Second)
-		tmp.Class = curInfo
-		toReturn = append(toReturn, tmp)
-		log.L.Debugf("Adding class time block for %v from %v to %v ", tmp.Class.ClassName, tmp.StartTime.In(time.Local), tmp.EndTime.In(time.Local))
-
-		lastClassEnd = tmpend
-	}
+		tmp.Shift = slice.Shift
 
-	if !lastClassEnd.Equal(end) {
-		//we need to generate one for the end block
-		tmp := r
-		tmp.StartTime = lastClassEnd
-		tmp.EndTime = end
-		tmp.ElapsedInSeconds = int64((tmp.EndTime.Sub(tmp.StartTime)) / time.Second)
-		log.L.Debugf("Adding back-padded time block %v %v ", tmp.StartTime.In(time.Local), tmp.EndTime.In(time.Local))
+		if class, ok := slice.Composite(); ok {
+			tmp.Class = classInfo(class)
+			log.L.Debugf("Adding class time block for %v from %v to %v ", tmp.Class.ClassName, tmp.StartTime.In(location), tmp.EndTime.In(location))
+		}
 
 		toReturn = append(toReturn, tmp)
 	}
@@ -582,12 +695,28 @@ func AddClassTimes(start, end time.Time, r ci.MetricsRecord) ([]ci.MetricsRecord
 	return toReturn, nil
 }
 
+func classInfo(c schedule.Class) ci.ClassInfo {
+	return ci.ClassInfo{
+		DeptName:        c.TeachingArea,
+		CatalogNumber:   c.CourseNumber,
+		ClassName:       fmt.Sprintf("%v-%v", c.TeachingArea, c.CourseNumber),
+		CreditHours:     c.CreditHours,
+		ClassSize:       c.SectionSize,
+		ClassEnrollment: c.Enrollment,
+		Instructor:      strings.Join(c.Instructors, "|"),
+
+		ClassStart: c.Start,
+		ClassEnd:   c.End,
+	}
+}
+
 //WrapAndSend .
 func (c *MachineCaterpillar) WrapAndSend(r ci.MetricsRecord) {
 	if r.ElapsedInSeconds < 1 {
 		return
 	}
 
+	r.ExceptionType = c.calendar.ExceptionType(r.StartTime)
 	printRecord(r)
 
 	c.outChan <- nydus.BulkRecordEntry{
@@ -608,67 +737,50 @@ func printRecord(r ci.MetricsRecord) {
 		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, r.Input, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
 	case "blank":
 		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, *r.Blanked, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
-	case "power":
+	case "power", "room-power":
 		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, r.Power, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "mute":
+		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, *r.Muted, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "availability":
+		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, *r.Online, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "room-use":
+		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, *r.InUse, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "room-class-use":
+		log.L.Debugf("Generating %v %v in use %v of %v Starting %v Ending %v", r.RecordType, r.Class.ClassName, *r.InUseSeconds, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "input-session":
+		log.L.Debugf("Generating %v %v switches %v Time %v Starting %v Ending %v", r.RecordType, r.Inputs, *r.SwitchCount, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
+	case "volume":
+		log.L.Debugf("Generating %v %v Time %v Starting %v Ending %v", r.RecordType, *r.Volume, r.ElapsedInSeconds, r.StartTime.In(location).Format("15:04:05 01-02"), r.EndTime.In(location).Format("15:04:05 01-02"))
 	}
 
 }
 
-//GetDeviceAndRoomInfo .
-func GetDeviceAndRoomInfo() (map[string]ci.DeviceInfo, map[string]ci.RoomInfo, *nerr.E) {
+//GetDeviceAndRoomInfo gets the devices and rooms from an inventory source (see inventory.ProviderFor). The inventory is cached and shared by every caterpillar, so this doesn't go to the database every run.
+func GetDeviceAndRoomInfo(source string) (map[string]ci.DeviceInfo, map[string]ci.RoomInfo, *nerr.E) {
 	toReturnDevice := map[string]ci.DeviceInfo{}
 	toReturnRooms := map[string]ci.RoomInfo{}
 
-	devs, err := db.GetDB().GetAllDevices()
+	inv, err := inventory.Get(source)
 	if err != nil {
-		if v, ok := err.(*nerr.E); ok {
-			return toReturnDevice, toReturnRooms, v.Addf("Coudn't get device and room info.")
-		}
 		return toReturnDevice, toReturnRooms, nerr.Translate(err).Addf("Couldn't get device and room info.")
 	}
-	log.L.Infof("Initializing device list with %v devices", len(devs))
-
-	for i := range devs {
-		tmp := ci.DeviceInfo{
-			ID:         devs[i].ID,
-			DeviceType: devs[i].Type.ID,
-			Tags:       devs[i].Tags,
-		}
-
-		//build the roles
-		for j := range devs[i].Roles {
-			tmp.DeviceRoles = append(tmp.DeviceRoles, devs[i].Roles[j].ID)
-		}
-
-		toReturnDevice[devs[i].ID] = tmp
-	}
 
-	rooms, err := db.GetDB().GetAllRooms()
-	if err != nil {
-		if v, ok := err.(*nerr.E); ok {
-			return toReturnDevice, toReturnRooms, v.Addf("Coudn't get device and room info.")
+	for id, d := range inv.Devices {
+		toReturnDevice[id] = ci.DeviceInfo{
+			ID:          d.ID,
+			DeviceType:  d.Type,
+			DeviceRoles: d.Roles,
+			Tags:        d.Tags,
 		}
-		return toReturnDevice, toReturnRooms, nerr.Translate(err).Addf("Couldn't get device and room info.")
 	}
 
-	log.L.Infof("Initializing room list with %v rooms", len(rooms))
-	for i := range rooms {
-		toReturnRooms[rooms[i].ID] = ci.RoomInfo{
-			ID:              rooms[i].ID,
-			Tags:            rooms[i].Tags,
-			DeploymentGroup: rooms[i].Designation,
+	for id, r := range inv.Rooms {
+		toReturnRooms[id] = ci.RoomInfo{
+			ID:              r.ID,
+			Tags:            r.Tags,
+			DeploymentGroup: r.DeploymentGroup,
 		}
 	}
 
 	return toReturnDevice, toReturnRooms, nil
 }
-
-func startOfDay(t time.Time) time.Time {
-	y, m, d := t.Date()
-	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
-}
-
-func endOfDay(t time.Time) time.Time {
-	y, m, d := t.Date()
-	return time.Date(y, m, d, 23, 59, 59, int(time.Second-time.Nanosecond), t.Location())
-}
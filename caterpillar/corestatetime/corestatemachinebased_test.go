@@ -0,0 +1,47 @@
+package corestatetime
+
+import (
+	"testing"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/v2/schedule"
+)
+
+func TestSliceRecord(t *testing.T) {
+	start := time.Date(2019, 9, 3, 22, 0, 0, 0, location)
+	classes := schedule.NewStatic([]schedule.Class{
+		{Room: "ITB-1101", TeachingArea: "C S", CourseNumber: "142", Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)},
+		{Room: "ITB-1101", TeachingArea: "EC EN", CourseNumber: "142", Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)},
+	})
+
+	records, err := sliceRecord(classes, schedule.Slicer{Classes: true, Midnight: true}, start, start.Add(4*time.Hour), ci.MetricsRecord{Room: ci.RoomInfo{ID: "ITB-1101"}})
+	if err != nil {
+		t.Fatalf("couldn't split record: %v", err.Error())
+	}
+
+	// before class, class until midnight, class after midnight, after class
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %v", len(records))
+	}
+
+	var total int64
+	for i, r := range records {
+		total += r.ElapsedInSeconds
+		if i > 0 && !r.StartTime.Equal(records[i-1].EndTime) {
+			t.Errorf("gap between %v and %v", records[i-1].EndTime, r.StartTime)
+		}
+	}
+	if total != 4*60*60 {
+		t.Errorf("expected 4 hours of records, got %v seconds", total)
+	}
+
+	for _, i := range []int{1, 2} {
+		if records[i].Class.ClassName != "C S/EC EN-142" {
+			t.Errorf("expected the cross-listed class in record %v, got %q", i, records[i].Class.ClassName)
+		}
+	}
+	if len(records[0].Class.ClassName) > 0 || len(records[3].Class.ClassName) > 0 {
+		t.Errorf("expected no class outside of class time")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/caterpillar/config"
 	"github.com/byuoitav/common/log"
 )
 
@@ -16,10 +18,24 @@ func TestBuildGraph(t *testing.T) {
 	}
 	log.SetLevel("debug")
 
-	m, err := mc.buildStateMachine()
+	machines, err := mc.buildStateMachines(config.Caterpillar{
+		TypeConfig: map[string]string{"machines": "device-state,room-power,mute,volume,availability,room-use,input-session"},
+	}, config.State{})
 	if err != nil {
 		log.L.Fatalf("Error: %v", err.Error())
 	}
 
-	m.PrintSimpleDotFile()
+	for _, m := range machines {
+		d, err := m.Render(sm.Dot, m.NodeCounts())
+		if err != nil {
+			t.Fatalf("Couldn't render %v: %v", m.Name, err.Error())
+		}
+		t.Logf("%s", d)
+
+		d, err = m.Render(sm.Mermaid, nil)
+		if err != nil {
+			t.Fatalf("Couldn't render %v: %v", m.Name, err.Error())
+		}
+		t.Logf("%s", d)
+	}
 }
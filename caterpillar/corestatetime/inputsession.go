@@ -0,0 +1,257 @@
+package corestatetime
+
+import (
+	"fmt"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+const defaultSessionGap = 15 * time.Minute
+
+//GetInputSessionCaterpillar is a MachineCaterpillar that groups each display's activity into input sessions.
+func GetInputSessionCaterpillar() (ci.Caterpillar, *nerr.E) {
+	toReturn := &MachineCaterpillar{
+		rectype:         "metrics",
+		devices:         map[string]ci.DeviceInfo{},
+		rooms:           map[string]ci.RoomInfo{},
+		defaultMachines: []string{"input-session"},
+	}
+
+	return toReturn, nil
+}
+
+//getSessionGap reads the session-idle-gap type-config (a duration, e.g. 20m).
+func getSessionGap(typeConfig map[string]string) (time.Duration, *nerr.E) {
+	v, ok := typeConfig["session-idle-gap"]
+	if !ok || len(v) == 0 {
+		return defaultSessionGap, nil
+	}
+
+	gap, err := time.ParseDuration(v)
+	if err != nil || gap <= 0 {
+		return 0, nerr.Create(fmt.Sprintf("Invalid session-idle-gap %v, must be a positive duration", v), "invalid-config")
+	}
+
+	return gap, nil
+}
+
+//inputSessionDefinition groups input, active-signal, and power activity on each display into sessions. A session starts when the display is
+//powered on or its input is changed, and ends when it's powered off or there's been no activity for longer than the idle gap.
+func (c *MachineCaterpillar) inputSessionDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["idle"] = sm.Node{
+		ID: "idle",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "on",
+				Destination:  "session",
+			},
+			sm.Transition{
+				TriggerKey:  "power",
+				Destination: "idle",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "input",
+				Guard:       NotStandby,
+				Destination: "session",
+			},
+			sm.Transition{
+				TriggerKey:  "input",
+				Destination: "idle",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+		},
+	}
+
+	Nodes["session"] = sm.Node{
+		ID: "session",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "standby",
+				Destination:  "idle",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+			sm.Transition{
+				ID:          "session-gap-input",
+				TriggerKey:  "input",
+				Guard:       c.SessionGapExceeded,
+				Destination: "session",
+			},
+			sm.Transition{
+				ID:          "session-gap-active-signal",
+				TriggerKey:  "active-signal",
+				Guard:       c.SessionGapExceeded,
+				Destination: "session",
+			},
+			sm.Transition{
+				ID:          "session-gap-power",
+				TriggerKey:  "power",
+				Guard:       c.SessionGapExceeded,
+				Destination: "session",
+			},
+			sm.Transition{
+				TriggerKey:  "input",
+				Destination: "session",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "active-signal",
+				Destination: "session",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "power",
+				Destination: "session",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					SessionActivityStore,
+				},
+			},
+		},
+		Enter: SessionStart,
+		Exit:  c.BuildSessionRecord,
+	}
+
+	return sm.Definition{
+		Name:      "input-session",
+		ScopeKey:  "deviceid",
+		Nodes:     Nodes,
+		StartNode: "idle",
+	}
+}
+
+//NotStandby is true unless we know the display is in standby.
+func NotStandby(state map[string]interface{}, e events.Event) bool {
+	return state["power"] != "standby"
+}
+
+//SessionGapExceeded is true if there's been no activity in the session for longer than the idle gap.
+func (c *MachineCaterpillar) SessionGapExceeded(state map[string]interface{}, e events.Event) bool {
+	last, ok := state["last-activity"].(time.Time)
+	return ok && c.sessionGap > 0 && e.Timestamp.Sub(last) > c.sessionGap
+}
+
+//SessionStart starts a new session with the display's current input.
+func SessionStart(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["session-start"] = e.Timestamp
+	state["session-inputs"] = []string{}
+	state["session-switches"] = 0
+
+	if e.Key != "input" {
+		if cur, ok := state["input"].(string); ok && len(cur) > 0 {
+			state["session-inputs"] = []string{cur}
+		}
+	}
+
+	return SessionActivityStore(state, e)
+}
+
+//SessionActivityStore records the time of the activity, and keeps track of the inputs used and the number of switches between them.
+func SessionActivityStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["last-activity"] = e.Timestamp
+
+	switch e.Key {
+	case "power":
+		state["power"] = e.Value
+	case "input":
+		if len(e.Value) == 0 {
+			break
+		}
+
+		cur, _ := state["input"].(string)
+		state["input"] = e.Value
+
+		inputs, ok := state["session-inputs"].([]string)
+		if !ok {
+			//not in a session
+			break
+		}
+		if cur != e.Value && len(inputs) > 0 {
+			switches, _ := state["session-switches"].(int)
+			state["session-switches"] = switches + 1
+		}
+
+		for _, i := range inputs {
+			if i == e.Value {
+				return []ci.MetricsRecord{}, nil
+			}
+		}
+		state["session-inputs"] = append(inputs, e.Value)
+	}
+
+	return []ci.MetricsRecord{}, nil
+}
+
+//BuildSessionRecord generates the record for the session. A session that ended because of the idle gap ends at the last activity.
+func (c *MachineCaterpillar) BuildSessionRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	startTime, ok := state["session-start"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("session-start not set to time.Time", "invalid-state")
+	}
+
+	end := e.Timestamp
+	if c.SessionGapExceeded(state, e) {
+		end, _ = state["last-activity"].(time.Time)
+	}
+
+	inputs, _ := state["session-inputs"].([]string)
+	switches, _ := state["session-switches"].(int)
+	delete(state, "session-inputs")
+
+	if !startTime.Before(end) {
+		return []ci.MetricsRecord{}, nil
+	}
+
+	toReturn := ci.MetricsRecord{
+		StartTime:        startTime,
+		EndTime:          end,
+		ElapsedInSeconds: int64(end.Sub(startTime) / time.Second),
+		RecordType:       ci.InputSession,
+		Building:         ci.BuildingInfo{ID: e.TargetDevice.BuildingID},
+		Inputs:           inputs,
+		SwitchCount:      &switches,
+	}
+
+	toReturn, err := c.addDeviceInfo(e, toReturn)
+	if err != nil {
+		return []ci.MetricsRecord{toReturn}, err
+	}
+
+	//sessions aren't split, they get the class they overlap the most.
+	classes, err := AddClassTimes(c.schedules, startTime, end, toReturn)
+	if err != nil {
+		return []ci.MetricsRecord{toReturn}, err.Addf("Couldn't add class info to session")
+	}
+	var most int64
+	for _, r := range classes {
+		if len(r.Class.ClassName) > 0 && r.ElapsedInSeconds > most {
+			most = r.ElapsedInSeconds
+			toReturn.Class = r.Class
+		}
+	}
+
+	return []ci.MetricsRecord{toReturn}, nil
+}
@@ -0,0 +1,39 @@
+package corestatetime
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestSessionStore(t *testing.T) {
+	gap, err := getSessionGap(map[string]string{"session-idle-gap": "10m"})
+	if err != nil {
+		t.Fatalf("couldn't get session gap: %v", err.Error())
+	}
+	mc := &MachineCaterpillar{sessionGap: gap}
+
+	start := time.Date(2019, 3, 4, 9, 0, 0, 0, location)
+	state := map[string]interface{}{"input": "HDMI1"}
+
+	SessionStart(state, events.Event{Key: "power", Value: "on", Timestamp: start})
+	for i, in := range []string{"HDMI1", "VIA1", "HDMI1", "HDMI2"} {
+		SessionActivityStore(state, events.Event{Key: "input", Value: in, Timestamp: start.Add(time.Duration(i+1) * time.Minute)})
+	}
+
+	if inputs := state["session-inputs"].([]string); !reflect.DeepEqual(inputs, []string{"HDMI1", "VIA1", "HDMI2"}) {
+		t.Errorf("unexpected inputs used %v", inputs)
+	}
+	if switches := state["session-switches"].(int); switches != 3 {
+		t.Errorf("expected 3 switches, got %v", switches)
+	}
+
+	if mc.SessionGapExceeded(state, events.Event{Key: "input", Timestamp: start.Add(10 * time.Minute)}) {
+		t.Errorf("expected activity within the gap to continue the session")
+	}
+	if !mc.SessionGapExceeded(state, events.Event{Key: "input", Timestamp: start.Add(20 * time.Minute)}) {
+		t.Errorf("expected the session to be over after the gap")
+	}
+}
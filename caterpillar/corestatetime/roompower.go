@@ -0,0 +1,144 @@
+package corestatetime
+
+import (
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//roomPowerDefinition tracks, for each room, how long any display in the room is powered on.
+func (c *MachineCaterpillar) roomPowerDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["start"] = sm.Node{
+		ID: "start",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "on",
+				Destination:  "roomon",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					RoomPowerStore,
+				},
+			},
+		},
+	}
+
+	Nodes["roomon"] = sm.Node{
+		ID: "roomon",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "standby",
+				Guard:        LastDeviceOff,
+				Destination:  "roomoff",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					RoomPowerStore,
+				},
+			},
+			sm.Transition{
+				TriggerKey:  "power",
+				Destination: "roomon",
+				Internal:    true,
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					RoomPowerStore,
+				},
+			},
+		},
+		Enter: RoomOnStore,
+	}
+
+	Nodes["roomoff"] = sm.Node{
+		ID: "roomoff",
+		Transitions: []sm.Transition{
+			sm.Transition{
+				TriggerKey:   "power",
+				TriggerValue: "on",
+				Destination:  "roomon",
+				Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+					RoomPowerStore,
+				},
+			},
+		},
+		Enter: c.RoomOffEnter,
+		Exit:  c.RoomOffExit,
+	}
+
+	return sm.Definition{
+		Name:      "room-power",
+		ScopeKey:  "roomid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
+}
+
+//RoomPowerStore keeps track of which devices in the room are powered on.
+func RoomPowerStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	powered, ok := state["powered-devices"].(map[string]bool)
+	if !ok {
+		powered = map[string]bool{}
+		state["powered-devices"] = powered
+	}
+
+	if e.Value == "on" {
+		powered[e.TargetDevice.DeviceID] = true
+	} else {
+		delete(powered, e.TargetDevice.DeviceID)
+	}
+
+	return []ci.MetricsRecord{}, nil
+}
+
+//LastDeviceOff returns true if the event turns off the only device in the room that's still on.
+func LastDeviceOff(state map[string]interface{}, e events.Event) bool {
+	powered, _ := state["powered-devices"].(map[string]bool)
+
+	for k := range powered {
+		if k != e.TargetDevice.DeviceID {
+			return false
+		}
+	}
+	return true
+}
+
+//RoomOnStore .
+func RoomOnStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["room-power-set"] = e.Timestamp
+	return []ci.MetricsRecord{}, nil
+}
+
+//RoomOffEnter generates the 'time room on' record.
+func (c *MachineCaterpillar) RoomOffEnter(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	toReturn := ci.MetricsRecord{
+		Power:      "on",
+		RecordType: ci.RoomPower,
+	}
+
+	startTime, ok := state["room-power-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("room-power-set not set to time.Time", "invalid-state")
+	}
+	state["room-power-set"] = e.Timestamp
+
+	return c.AddRoomMetaInfo(startTime, e, toReturn)
+}
+
+//RoomOffExit generates the 'time room off' record.
+func (c *MachineCaterpillar) RoomOffExit(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	toReturn := ci.MetricsRecord{
+		Power:      "standby",
+		RecordType: ci.RoomPower,
+	}
+
+	startTime, ok := state["room-power-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("room-power-set not set to time.Time", "invalid-state")
+	}
+	state["room-power-set"] = e.Timestamp
+
+	return c.AddRoomMetaInfo(startTime, e, toReturn)
+}
@@ -0,0 +1,283 @@
+package corestatetime
+
+import (
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//roomUseKeys are the events that can change whether a room is in use.
+var roomUseKeys = []string{"power", "blanked", "input", "active-signal"}
+
+//DisplayStatus is what we know about a display in a room, kept in the room-use machine's store.
+type DisplayStatus struct {
+	Power    bool
+	Blanked  bool
+	Input    string
+	NoSignal bool //only set once an active-signal event says the input has no signal.
+}
+
+//InUse is true if the display is on, unblanked, and showing an active input.
+func (d DisplayStatus) InUse() bool {
+	return d.Power && !d.Blanked && len(d.Input) > 0 && !d.NoSignal
+}
+
+//ClassUse accumulates the time a room is in use during a class, so the class can be rolled up once it's over.
+type ClassUse struct {
+	Class        ci.ClassInfo
+	Room         ci.RoomInfo
+	Building     ci.BuildingInfo
+	InUseSeconds int64
+}
+
+//GetRoomUtilizationCaterpillar is a MachineCaterpillar that tracks when each room is in use.
+func GetRoomUtilizationCaterpillar() (ci.Caterpillar, *nerr.E) {
+	toReturn := &MachineCaterpillar{
+		rectype:         "metrics",
+		devices:         map[string]ci.DeviceInfo{},
+		rooms:           map[string]ci.RoomInfo{},
+		defaultMachines: []string{"room-use"},
+	}
+
+	return toReturn, nil
+}
+
+//roomUseDefinition tracks, for each room, the time it's in use: any display in the room is on and unblanked with an active input.
+//Records are split by class and by hour, and a room-class-use record is generated for each class held in the room.
+func (c *MachineCaterpillar) roomUseDefinition() sm.Definition {
+
+	Nodes := map[string]sm.Node{}
+
+	Nodes["start"] = sm.Node{
+		ID:          "start",
+		Transitions: append(c.roomUseTransitions(c.RoomInUseAfter, "inuse", false), c.roomUseTransitions(nil, "idle", false)...),
+	}
+
+	Nodes["idle"] = sm.Node{
+		ID:          "idle",
+		Transitions: append(c.roomUseTransitions(c.RoomInUseAfter, "inuse", false), c.roomUseTransitions(nil, "idle", true)...),
+		Enter:       RoomUseEnter,
+		Exit:        c.BuildRoomUseRecord,
+	}
+
+	Nodes["inuse"] = sm.Node{
+		ID:          "inuse",
+		Transitions: append(c.roomUseTransitions(c.RoomIdleAfter, "idle", false), c.roomUseTransitions(nil, "inuse", true)...),
+		Enter:       RoomUseEnter,
+		Exit:        c.BuildRoomUseRecord,
+	}
+
+	return sm.Definition{
+		Name:      "room-use",
+		ScopeKey:  "roomid",
+		Nodes:     Nodes,
+		StartNode: "start",
+	}
+}
+
+//roomUseTransitions builds a transition on each of the roomUseKeys, each of which keeps the display store up to date.
+func (c *MachineCaterpillar) roomUseTransitions(guard func(map[string]interface{}, events.Event) bool, dst string, internal bool) []sm.Transition {
+	toReturn := []sm.Transition{}
+
+	for _, k := range roomUseKeys {
+		toReturn = append(toReturn, sm.Transition{
+			TriggerKey:  k,
+			Guard:       guard,
+			Destination: dst,
+			Internal:    internal,
+			Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){
+				c.DisplayStore,
+			},
+		})
+	}
+
+	return toReturn
+}
+
+//applyDisplayEvent returns the display's status after the event.
+func applyDisplayEvent(d DisplayStatus, e events.Event) DisplayStatus {
+	switch e.Key {
+	case "power":
+		d.Power = e.Value == "on"
+	case "blanked":
+		d.Blanked = e.Value == "true"
+	case "input":
+		if d.Input != e.Value {
+			d.NoSignal = false
+		}
+		d.Input = e.Value
+	case "active-signal":
+		d.NoSignal = e.Value == "false"
+	}
+	return d
+}
+
+func getDisplays(state map[string]interface{}) map[string]DisplayStatus {
+	displays, ok := state["displays"].(map[string]DisplayStatus)
+	if !ok {
+		displays = map[string]DisplayStatus{}
+		state["displays"] = displays
+	}
+	return displays
+}
+
+//isDisplay is false for devices we know aren't displays, so e.g. a switcher changing inputs doesn't put the room in use.
+func (c *MachineCaterpillar) isDisplay(id string) bool {
+	dev, ok := c.devices[id]
+	if !ok || len(dev.DeviceRoles) == 0 {
+		return true
+	}
+
+	for _, r := range dev.DeviceRoles {
+		if r == "VideoOut" {
+			return true
+		}
+	}
+	return false
+}
+
+//roomInUseAfter checks if any display in the room will be in use once the event is applied.
+func (c *MachineCaterpillar) roomInUseAfter(state map[string]interface{}, e events.Event) bool {
+	displays, _ := state["displays"].(map[string]DisplayStatus)
+
+	id := e.TargetDevice.DeviceID
+	if c.isDisplay(id) && applyDisplayEvent(displays[id], e).InUse() {
+		return true
+	}
+
+	for k, d := range displays {
+		if k != id && d.InUse() {
+			return true
+		}
+	}
+	return false
+}
+
+//roomInUse checks the stored displays, i.e. the status of the room up until the current event.
+func roomInUse(state map[string]interface{}) bool {
+	displays, _ := state["displays"].(map[string]DisplayStatus)
+
+	for _, d := range displays {
+		if d.InUse() {
+			return true
+		}
+	}
+	return false
+}
+
+//RoomInUseAfter is true if the event puts the room in use.
+func (c *MachineCaterpillar) RoomInUseAfter(state map[string]interface{}, e events.Event) bool {
+	return c.roomInUseAfter(state, e)
+}
+
+//RoomIdleAfter is true if the event leaves no displays in use in the room.
+func (c *MachineCaterpillar) RoomIdleAfter(state map[string]interface{}, e events.Event) bool {
+	return !c.roomInUseAfter(state, e)
+}
+
+//DisplayStore keeps track of the status of each display in the room.
+func (c *MachineCaterpillar) DisplayStore(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	if !c.isDisplay(e.TargetDevice.DeviceID) {
+		return []ci.MetricsRecord{}, nil
+	}
+
+	displays := getDisplays(state)
+	displays[e.TargetDevice.DeviceID] = applyDisplayEvent(displays[e.TargetDevice.DeviceID], e)
+	return []ci.MetricsRecord{}, nil
+}
+
+//RoomUseEnter .
+func RoomUseEnter(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	state["room-use-set"] = e.Timestamp
+	return []ci.MetricsRecord{}, nil
+}
+
+//BuildRoomUseRecord generates the in use (or idle) records for the room, split by class and hour, and rolls up any classes that have finished.
+func (c *MachineCaterpillar) BuildRoomUseRecord(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+	startTime, ok := state["room-use-set"].(time.Time)
+	if !ok {
+		return []ci.MetricsRecord{}, nerr.Create("room-use-set not set to time.Time", "invalid-state")
+	}
+
+	inUse := &False
+	if roomInUse(state) {
+		inUse = &True
+	}
+
+	toReturn := ci.MetricsRecord{
+		InUse:      inUse,
+		RecordType: ci.RoomUse,
+		Building:   ci.BuildingInfo{ID: e.TargetDevice.BuildingID},
+	}
+
+	//the class rollups need records split on class boundaries, and room use is reported by the hour, whatever the slicing type-config says.
+	slicer := c.slicer
+	slicer.Classes = true
+	if slicer.Every <= 0 || time.Hour%slicer.Every != 0 {
+		slicer.Every = time.Hour
+	}
+
+	records, err := c.addRoomMetaInfo(slicer, startTime, e, toReturn)
+	if err != nil {
+		return records, err
+	}
+
+	return append(records, rollupClasses(state, records)...), nil
+}
+
+//rollupClasses adds the room-use records to the class they're in. Once records start after a class has ended, the room-class-use record for that class is returned.
+func rollupClasses(state map[string]interface{}, records []ci.MetricsRecord) []ci.MetricsRecord {
+	toReturn := []ci.MetricsRecord{}
+
+	cur, ok := state["class-use"].(ClassUse)
+	for _, r := range records {
+		if ok && !r.StartTime.Before(cur.Class.ClassEnd) {
+			toReturn = append(toReturn, cur.record())
+			ok = false
+		}
+
+		if r.Class.ClassEnd.IsZero() {
+			continue
+		}
+
+		if !ok || !cur.Class.ClassStart.Equal(r.Class.ClassStart) || cur.Class.ClassName != r.Class.ClassName {
+			if ok {
+				toReturn = append(toReturn, cur.record())
+			}
+			cur = ClassUse{Class: r.Class, Room: r.Room, Building: r.Building}
+			ok = true
+		}
+
+		if r.InUse != nil && *r.InUse {
+			cur.InUseSeconds += r.ElapsedInSeconds
+		}
+	}
+
+	if ok {
+		state["class-use"] = cur
+	} else {
+		delete(state, "class-use")
+	}
+
+	return toReturn
+}
+
+func (cu ClassUse) record() ci.MetricsRecord {
+	inUse := cu.InUseSeconds
+	unused := inUse == 0
+
+	return ci.MetricsRecord{
+		StartTime:        cu.Class.ClassStart,
+		EndTime:          cu.Class.ClassEnd,
+		ElapsedInSeconds: int64(cu.Class.ClassEnd.Sub(cu.Class.ClassStart) / time.Second),
+		RecordType:       ci.RoomClassUse,
+		Room:             cu.Room,
+		Building:         cu.Building,
+		Class:            cu.Class,
+		InUseSeconds:     &inUse,
+		ScheduledUnused:  &unused,
+	}
+}
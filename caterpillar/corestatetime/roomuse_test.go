@@ -0,0 +1,126 @@
+package corestatetime
+
+import (
+	"testing"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/v2/schedule"
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestRoomInUse(t *testing.T) {
+	mc := &MachineCaterpillar{
+		devices: map[string]ci.DeviceInfo{
+			"ITB-1101-D1":  {ID: "ITB-1101-D1", DeviceRoles: []string{"VideoOut"}},
+			"ITB-1101-SW1": {ID: "ITB-1101-SW1", DeviceRoles: []string{"VideoSwitcher"}},
+		},
+	}
+	state := map[string]interface{}{}
+
+	apply := func(dev, key, value string) bool {
+		e := events.Event{Key: key, Value: value, TargetDevice: events.BasicDeviceInfo{DeviceID: dev}}
+		after := mc.RoomInUseAfter(state, e)
+		mc.DisplayStore(state, e)
+		if after != roomInUse(state) {
+			t.Fatalf("guard and store disagree after %v %v=%v", dev, key, value)
+		}
+		return after
+	}
+
+	if apply("ITB-1101-D1", "power", "on") {
+		t.Errorf("expected a display without an input to leave the room idle")
+	}
+	if apply("ITB-1101-SW1", "input", "HDMI1") {
+		t.Errorf("expected a switcher's input to be ignored")
+	}
+	if !apply("ITB-1101-D1", "input", "HDMI1") {
+		t.Errorf("expected a display on with an input to put the room in use")
+	}
+	if apply("ITB-1101-D1", "active-signal", "false") {
+		t.Errorf("expected no signal to leave the room idle")
+	}
+	if !apply("ITB-1101-D1", "input", "VIA1") {
+		t.Errorf("expected a new input to clear no signal")
+	}
+	if apply("ITB-1101-D1", "blanked", "true") {
+		t.Errorf("expected a blanked display to leave the room idle")
+	}
+}
+
+func TestRollupClasses(t *testing.T) {
+	start := time.Date(2019, 3, 4, 9, 0, 0, 0, location)
+	class := ci.ClassInfo{ClassName: "C S-142", ClassStart: start, ClassEnd: start.Add(50 * time.Minute)}
+
+	rec := func(from, to time.Duration, inUse bool, c ci.ClassInfo) ci.MetricsRecord {
+		u := inUse
+		return ci.MetricsRecord{StartTime: start.Add(from), EndTime: start.Add(to), ElapsedInSeconds: int64((to - from) / time.Second), InUse: &u, Class: c}
+	}
+
+	state := map[string]interface{}{}
+	classes := schedule.NewStatic([]schedule.Class{{Room: "ITB-1101", TeachingArea: "C S", CourseNumber: "142", Start: start, End: start.Add(50 * time.Minute)}})
+	records, err := sliceRecord(classes, schedule.Slicer{Classes: true, Every: time.Hour}, start.Add(-30*time.Minute), start.Add(20*time.Minute), ci.MetricsRecord{Room: ci.RoomInfo{ID: "ITB-1101"}, InUse: &False})
+	if err != nil {
+		t.Fatalf("couldn't slice record: %v", err.Error())
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the record to be split on the hour, got %v records", len(records))
+	}
+
+	if out := rollupClasses(state, records); len(out) != 0 {
+		t.Fatalf("expected the class to still be open")
+	}
+	out := rollupClasses(state, []ci.MetricsRecord{rec(20*time.Minute, 50*time.Minute, true, class), rec(50*time.Minute, 60*time.Minute, false, ci.ClassInfo{})})
+	if len(out) != 1 {
+		t.Fatalf("expected one class rollup, got %v", len(out))
+	}
+	if *out[0].InUseSeconds != 30*60 || *out[0].ScheduledUnused {
+		t.Errorf("expected the class to be in use for 30 minutes, got %v", *out[0].InUseSeconds)
+	}
+
+	out = rollupClasses(state, []ci.MetricsRecord{rec(2*time.Hour, 3*time.Hour, false, ci.ClassInfo{ClassName: "MATH-112", ClassStart: start.Add(2 * time.Hour), ClassEnd: start.Add(3 * time.Hour)}), rec(3*time.Hour, 4*time.Hour, false, ci.ClassInfo{})})
+	if len(out) != 1 || !*out[0].ScheduledUnused {
+		t.Errorf("expected the second class to be flagged as scheduled but unused")
+	}
+}
+
+func TestRoomUseSlicing(t *testing.T) {
+	start := time.Date(2019, 3, 4, 9, 0, 0, 0, location)
+	mc := &MachineCaterpillar{
+		devices: map[string]ci.DeviceInfo{"ITB-1101-D1": {ID: "ITB-1101-D1", DeviceRoles: []string{"VideoOut"}}},
+		rooms:   map[string]ci.RoomInfo{"ITB-1101": {ID: "ITB-1101"}},
+		schedules: schedule.NewStatic([]schedule.Class{
+			{Room: "ITB-1101", TeachingArea: "C S", CourseNumber: "142", Start: start.Add(15 * time.Minute), End: start.Add(45 * time.Minute)},
+		}),
+		slicer: schedule.Slicer{Every: time.Hour}, //slicing: hourly, without class
+	}
+
+	dev := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	state := map[string]interface{}{}
+	for _, e := range []events.Event{{Key: "power", Value: "on"}, {Key: "input", Value: "HDMI1"}} {
+		e.TargetDevice = dev
+		e.Timestamp = start
+		mc.DisplayStore(state, e)
+	}
+	RoomUseEnter(state, events.Event{Timestamp: start})
+
+	records, err := mc.BuildRoomUseRecord(state, events.Event{Key: "power", Value: "standby", Timestamp: start.Add(90 * time.Minute), TargetDevice: dev})
+	if err != nil {
+		t.Fatalf("couldn't build room use records: %v", err.Error())
+	}
+
+	found := false
+	for _, r := range records {
+		if r.RecordType != ci.RoomClassUse {
+			continue
+		}
+
+		found = true
+		if *r.InUseSeconds != 30*60 {
+			t.Errorf("expected the class to be in use for its 30 minutes, got %v seconds", *r.InUseSeconds)
+		}
+	}
+	if !found {
+		t.Errorf("expected the class to be rolled up")
+	}
+}
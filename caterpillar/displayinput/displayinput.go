@@ -0,0 +1,165 @@
+package displayinput
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/metrics"
+	"github.com/byuoitav/caterpillar/nydus"
+	dic "github.com/byuoitav/caterpillar/v2/displayinputcaterpillar"
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//Caterpillar runs the v2 display input caterpillar on the events from the hatchery's feeder. Records go to SQL rather than through nydus.
+//
+//type-config:
+//	buildings             - comma separated list of buildings to process, all buildings in the feed if empty.
+//	table                 - the table to store records in, defaults to DisplayInputMetrics.
+//	schema                - the schema the tables are in, defaults to dbo on sqlserver and public on postgres.
+//	workers               - the number of devices to process at once, defaults to 10.
+//	sql-driver            - sqlserver, postgres, or sqlite3. defaults to METRICS_SQL_DRIVER, then sqlserver.
+//	sql-connection-string - defaults to METRICS_SQL_CONNECTION_STRING.
+//	calendar              - where to get holidays, breaks, and finals from: a .ics or .csv file or url, or sql for the ExceptionDates table in the database above.
+//	class-schedule        - where to get class schedules from: uapi (the default), registar, or a .json or .csv file.
+//	inventory             - where to get each device's room from: couch (the default, the same as the corestatetime caterpillars), a url, or a .json file.
+//	slicing               - how records are split, see schedule.ParseSlicer. defaults to hourly,class.
+//	migrate               - if true, any pending schema migrations are applied before each run. They can also be applied with `caterpillar migrate`.
+type Caterpillar struct {
+	eventErrors []ci.EventError
+	windowEnd   time.Time //the end of the events being fed, see SetWindow.
+}
+
+//GetCaterpillar .
+func GetCaterpillar() (ci.Caterpillar, *nerr.E) {
+	return &Caterpillar{}, nil
+}
+
+//GetConfig builds the v2 config from the type-config.
+func GetConfig(typeConfig map[string]string) dic.Config {
+	toReturn := dic.Config{
+		Table:     strings.TrimSpace(typeConfig["table"]),
+		Migrate:   strings.TrimSpace(typeConfig["migrate"]) == "true",
+		Calendar:  strings.TrimSpace(typeConfig["calendar"]),
+		Schedule:  strings.TrimSpace(typeConfig["class-schedule"]),
+		Inventory: strings.TrimSpace(typeConfig["inventory"]),
+		Slicing:   strings.TrimSpace(typeConfig["slicing"]),
+		SQL: metricssql.Config{
+			Driver:           strings.TrimSpace(typeConfig["sql-driver"]),
+			ConnectionString: strings.TrimSpace(typeConfig["sql-connection-string"]),
+			Schema:           strings.TrimSpace(typeConfig["schema"]),
+		},
+	}
+
+	if w, err := strconv.Atoi(strings.TrimSpace(typeConfig["workers"])); err == nil {
+		toReturn.Workers = w
+	}
+
+	for _, b := range strings.Split(typeConfig["buildings"], ",") {
+		if b = strings.TrimSpace(b); len(b) > 0 {
+			toReturn.Buildings = append(toReturn.Buildings, b)
+		}
+	}
+
+	return toReturn
+}
+
+//Run fulfils the Caterpillar interface.
+//Events are grouped by device and each device is processed from its last known state in SQL, several at once. A failure on one device doesn't stop the others,
+//and the failures go in the run's history (see EventErrors). The run only fails if every device did, but if any did the window isn't moved on,
+//so the failed devices' events are fed again next run. The devices that didn't fail skip the events they've already processed.
+func (c *Caterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, cnfg config.Caterpillar, GetData func(int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
+	dicConfig := GetConfig(cnfg.TypeConfig)
+
+	cat, er := dic.New(dicConfig)
+	if er != nil {
+		return state, nerr.Translate(er).Addf("Couldn't run display input caterpillar %v", id)
+	}
+	defer cat.Close()
+
+	inchan, err := GetData(1000)
+	if err != nil {
+		return state, err.Addf("Couldn't run display input caterpillar %v", id)
+	}
+
+	buildings := map[string]bool{}
+	for _, b := range dicConfig.Buildings {
+		buildings[b] = true
+	}
+	keys := map[string]bool{}
+	for _, k := range dic.Keys {
+		keys[k] = true
+	}
+
+	devices := map[string][]events.Event{}
+	lastTime := state.LastEventTime
+	for i := range inchan {
+		e, ok := i.(events.Event)
+		if !ok {
+			log.L.Warnf("Unkown type in channel %v", i)
+			continue
+		}
+		lastTime = e.Timestamp
+
+		if !keys[e.Key] || len(e.TargetDevice.DeviceID) == 0 {
+			continue
+		}
+		if len(buildings) > 0 && !buildings[e.TargetDevice.BuildingID] {
+			continue
+		}
+
+		devices[e.TargetDevice.DeviceID] = append(devices[e.TargetDevice.DeviceID], e)
+	}
+
+	summary := cat.ProcessDevices(devices, c.windowEnd)
+	log.L.Infof("Display input caterpillar %v: %v", id, summary)
+
+	c.eventErrors = nil
+	for device, er := range summary.FailedDevices {
+		c.eventErrors = append(c.eventErrors, ci.EventError{
+			Time:   lastTime,
+			Device: device,
+			Error:  er,
+		})
+	}
+	metrics.RecordsEmitted.WithLabelValues(id, "display-input").Add(float64(summary.RecordsWritten))
+
+	toReturn := config.State{
+		LastEventTime: lastTime,
+		Data:          state.Data,
+	}
+
+	if er := summary.Err(); er != nil {
+		if summary.Failed == summary.Devices {
+			return toReturn, nerr.Translate(er).Addf("Couldn't run display input caterpillar %v", id)
+		}
+		log.L.Warnf("Display input caterpillar %v: %v. Running the window again next time.", id, er.Error())
+		toReturn.LastEventTime = state.LastEventTime
+	}
+
+	return toReturn, nil
+}
+
+//SetWindow fulfills the catinter.Windowed interface. Device state isn't carried past the end of the window.
+func (c *Caterpillar) SetWindow(start, end time.Time) {
+	c.windowEnd = end
+}
+
+//EventErrors fulfills the catinter.EventErrorReporter interface, with one error for each device that failed in the last run.
+func (c *Caterpillar) EventErrors() []ci.EventError {
+	return c.eventErrors
+}
+
+//RegisterGobStructs .
+func (c *Caterpillar) RegisterGobStructs() {
+}
+
+//WrapAndSend isn't used, records are stored straight to SQL.
+func (c *Caterpillar) WrapAndSend(r ci.MetricsRecord) {
+	log.L.Debugf("Display input caterpillar doesn't send metrics records, dropping %v", r)
+}
@@ -0,0 +1,127 @@
+package displayinput
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestFailedDeviceFedAgain(t *testing.T) {
+	dir, er := ioutil.TempDir("", "displayinput")
+	if er != nil {
+		t.Fatalf("couldn't make temp dir: %v", er)
+	}
+	defer os.RemoveAll(dir)
+
+	classes := filepath.Join(dir, "classes.json")
+	if er := ioutil.WriteFile(classes, []byte("[]"), 0644); er != nil {
+		t.Fatalf("couldn't write schedule: %v", er)
+	}
+
+	inv := filepath.Join(dir, "inventory.json")
+	if er := ioutil.WriteFile(inv, []byte(`{"devices": [{"id": "ITB-1101-D1"}, {"id": "ITB-1101-D2"}], "rooms": [{"id": "ITB-1101"}]}`), 0644); er != nil {
+		t.Fatalf("couldn't write inventory: %v", er)
+	}
+
+	sqlConfig := metricssql.Config{Driver: metricssql.SQLite, ConnectionString: filepath.Join(dir, "metrics.db")}
+	cnfg := config.Caterpillar{
+		ID: "display-input-test",
+		TypeConfig: map[string]string{
+			"sql-driver":            sqlConfig.Driver,
+			"sql-connection-string": sqlConfig.ConnectionString,
+			"class-schedule":        classes,
+			"inventory":             inv,
+			"migrate":               "true",
+		},
+	}
+
+	db, er := metricssql.Open(sqlConfig)
+	if er != nil {
+		t.Fatalf("couldn't open db: %v", er)
+	}
+	defer db.Close()
+	if _, er := db.Migrate(); er != nil {
+		t.Fatalf("couldn't migrate: %v", er)
+	}
+
+	//D2's last known state can't be read, so it fails
+	setState := func(device, state string) {
+		tx, er := db.Begin()
+		if er != nil {
+			t.Fatalf("couldn't start txn: %v", er)
+		}
+		if er := db.UpsertLastKnownState(tx, device, time.Time{}, state); er != nil {
+			tx.Rollback()
+			t.Fatalf("couldn't set last known state: %v", er)
+		}
+		if er := tx.Commit(); er != nil {
+			t.Fatalf("couldn't commit: %v", er)
+		}
+	}
+	setState("ITB-1101-D2", "{")
+
+	start := time.Now().Truncate(time.Hour).Add(-4 * time.Hour)
+	device := func(id string) events.BasicDeviceInfo {
+		return events.BasicDeviceInfo{DeviceID: id, BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	}
+	feed := []events.Event{
+		{Key: "power", Value: "on", Timestamp: start.Add(10 * time.Minute), TargetDevice: device("ITB-1101-D1")},
+		{Key: "power", Value: "on", Timestamp: start.Add(20 * time.Minute), TargetDevice: device("ITB-1101-D2")},
+		{Key: "input", Value: "hdmi1", Timestamp: start.Add(30 * time.Minute), TargetDevice: device("ITB-1101-D1")},
+		{Key: "power", Value: "standby", Timestamp: start.Add(40 * time.Minute), TargetDevice: device("ITB-1101-D2")},
+	}
+	getData := func(int) (chan interface{}, *nerr.E) {
+		ch := make(chan interface{}, len(feed))
+		for _, e := range feed {
+			ch <- e
+		}
+		close(ch)
+		return ch, nil
+	}
+	rows := func(device string) int {
+		var n int
+		if er := db.Get(&n, db.Rebind(`SELECT COUNT(*) FROM "DisplayInputMetrics" WHERE "DeviceID" = ?`), device); er != nil {
+			t.Fatalf("couldn't count records: %v", er)
+		}
+		return n
+	}
+
+	c := &Caterpillar{}
+	state, err := c.Run(cnfg.ID, len(feed), config.State{LastEventTime: start}, nil, cnfg, getData)
+	if err != nil {
+		t.Fatalf("expected a partial failure not to fail the run: %v", err.Error())
+	}
+	if !state.LastEventTime.Equal(start) {
+		t.Fatalf("expected the window to be held at %v with a failed device, got %v", start, state.LastEventTime)
+	}
+	if len(c.EventErrors()) != 1 || c.EventErrors()[0].Device != "ITB-1101-D2" {
+		t.Fatalf("expected an error for ITB-1101-D2, got %v", c.EventErrors())
+	}
+	d1 := rows("ITB-1101-D1")
+	if d1 == 0 || rows("ITB-1101-D2") != 0 {
+		t.Fatalf("expected records for only ITB-1101-D1, got %v and %v", d1, rows("ITB-1101-D2"))
+	}
+
+	//once D2 is fixed the same window is fed again
+	setState("ITB-1101-D2", "")
+	state, err = c.Run(cnfg.ID, len(feed), state, nil, cnfg, getData)
+	if err != nil {
+		t.Fatalf("couldn't run again: %v", err.Error())
+	}
+	if !state.LastEventTime.Equal(feed[len(feed)-1].Timestamp) {
+		t.Errorf("expected the window to move on to %v, got %v", feed[len(feed)-1].Timestamp, state.LastEventTime)
+	}
+	if rows("ITB-1101-D2") == 0 {
+		t.Errorf("expected ITB-1101-D2's events to be processed the second time")
+	}
+	if n := rows("ITB-1101-D1"); n != d1 {
+		t.Errorf("expected ITB-1101-D1's records to be left as they were, had %v now %v", d1, n)
+	}
+}
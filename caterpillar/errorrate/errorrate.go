@@ -0,0 +1,315 @@
+package errorrate
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/caterpillar/corestatetime"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/caterpillar/caterpillar/timebucket"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/nydus"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+const (
+	defaultInterval    = timebucket.Hour
+	defaultTopMessages = 5
+
+	//maxMessages caps the number of distinct messages tracked in a bucket, so a noisy device can't blow up the stored state.
+	maxMessages = 500
+)
+
+var location *time.Location
+
+func init() {
+	var er error
+	location, er = time.LoadLocation("America/Denver")
+	if er != nil {
+		log.L.Fatalf("Couldn't load timezone: %v", er.Error())
+	}
+}
+
+//Caterpillar counts error events per device, room, or building in fixed time buckets.
+//Events are errors if their key is in error-keys, or they have one of the tags in error-tags (error by default).
+type Caterpillar struct {
+	outChan chan nydus.BulkRecordEntry
+	index   string
+
+	cnfg counterConfig
+
+	devices map[string]ci.DeviceInfo
+	rooms   map[string]ci.RoomInfo
+
+	GobRegisterOnce sync.Once
+}
+
+type counterConfig struct {
+	keys        map[string]bool
+	tags        map[string]bool
+	scopeKey    string
+	interval    timebucket.Interval
+	topMessages int
+}
+
+//Bucket is the error count for a device, room, or building in its current bucket, kept in the caterpillar's state (see timebucket).
+type Bucket struct {
+	Target   events.BasicDeviceInfo
+	Start    time.Time
+	Count    int
+	Messages map[string]int
+}
+
+//GetCaterpillar .
+func GetCaterpillar() (ci.Caterpillar, *nerr.E) {
+	return &Caterpillar{
+		devices: map[string]ci.DeviceInfo{},
+		rooms:   map[string]ci.RoomInfo{},
+	}, nil
+}
+
+//Run fulfils the Caterpillar interface.
+func (c *Caterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, cnfg config.Caterpillar, GetData func(int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
+	index, ok := cnfg.TypeConfig["output-index"]
+	if !ok {
+		return state, nerr.Create(fmt.Sprintf("Missing config item for Caterpillar type %v. Need output-index", cnfg.Type), "invalid-config")
+	}
+
+	c.index = index
+	c.outChan = outChan
+
+	var err *nerr.E
+	c.cnfg, err = getConfig(cnfg.TypeConfig)
+	if err != nil {
+		return state, err.Addf("Couldn't run error rate caterpillar %v", id)
+	}
+
+	c.devices, c.rooms, err = corestatetime.GetDeviceAndRoomInfo(cnfg.TypeConfig["inventory"])
+	if err != nil {
+		return state, err.Addf("Couldn't run error rate caterpillar %v", id)
+	}
+
+	buckets := map[string]Bucket{}
+	if v, ok := state.Data.(map[string]Bucket); ok {
+		buckets = v
+	}
+
+	inchan, err := GetData(1000)
+	if err != nil {
+		return state, err.Addf("Couldn't run error rate caterpillar %v", id)
+	}
+
+	lastTime := state.LastEventTime
+	for i := range inchan {
+		e, ok := i.(events.Event)
+		if !ok {
+			log.L.Warnf("Unkown type in channel %v", i)
+			continue
+		}
+		lastTime = e.Timestamp
+
+		if !c.cnfg.isError(e) {
+			continue
+		}
+
+		scope, err := sm.GetScope(c.cnfg.scopeKey, e)
+		if err != nil || len(scope) == 0 {
+			continue
+		}
+
+		cur, rec := c.cnfg.countEvent(buckets[scope], e)
+		buckets[scope] = cur
+		if rec != nil {
+			c.WrapAndSend(*rec)
+		}
+	}
+
+	for k, v := range buckets {
+		if !c.cnfg.interval.Ended(v.Start, lastTime) {
+			continue
+		}
+		if rec := c.cnfg.record(v); rec != nil {
+			c.WrapAndSend(*rec)
+		}
+		delete(buckets, k)
+	}
+
+	return config.State{
+		LastEventTime: lastTime,
+		Data:          buckets,
+	}, nil
+}
+
+func getConfig(typeConfig map[string]string) (counterConfig, *nerr.E) {
+	toReturn := counterConfig{
+		keys:        splitSet(typeConfig["error-keys"]),
+		tags:        splitSet(typeConfig["error-tags"]),
+		scopeKey:    "deviceid",
+		interval:    defaultInterval,
+		topMessages: defaultTopMessages,
+	}
+
+	if len(toReturn.keys) == 0 && len(toReturn.tags) == 0 {
+		toReturn.tags[events.Error] = true
+	}
+
+	if v, ok := typeConfig["scope"]; ok && len(v) > 0 {
+		if v != "deviceid" && v != "roomid" && v != "buildingid" {
+			return toReturn, nerr.Create(fmt.Sprintf("Invalid scope %v, must be deviceid, roomid, or buildingid", v), "invalid-config")
+		}
+		toReturn.scopeKey = v
+	}
+
+	if v, ok := typeConfig["bucket-interval"]; ok && len(v) > 0 {
+		var err *nerr.E
+		toReturn.interval, err = timebucket.Parse(v)
+		if err != nil {
+			return toReturn, err
+		}
+	}
+
+	if v, ok := typeConfig["top-messages"]; ok && len(v) > 0 {
+		var err error
+		toReturn.topMessages, err = strconv.Atoi(v)
+		if err != nil || toReturn.topMessages < 0 {
+			return toReturn, nerr.Create(fmt.Sprintf("Invalid top-messages %v", v), "invalid-config")
+		}
+	}
+
+	return toReturn, nil
+}
+
+func splitSet(v string) map[string]bool {
+	toReturn := map[string]bool{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			toReturn[s] = true
+		}
+	}
+	return toReturn
+}
+
+func (cc counterConfig) isError(e events.Event) bool {
+	if cc.keys[e.Key] {
+		return true
+	}
+	for _, t := range e.EventTags {
+		if cc.tags[t] {
+			return true
+		}
+	}
+	return false
+}
+
+//countEvent adds the event to the scope's bucket. If the event falls in a new bucket the record for the finished bucket is returned.
+func (cc counterConfig) countEvent(cur Bucket, e events.Event) (Bucket, *ci.MetricsRecord) {
+	var toReturn *ci.MetricsRecord
+
+	start := cc.interval.Start(e.Timestamp)
+	if !cur.Start.Equal(start) {
+		if !cur.Start.IsZero() {
+			toReturn = cc.record(cur)
+		}
+		cur = Bucket{Start: start, Messages: map[string]int{}}
+	}
+
+	cur.Count++
+	cur.Target = e.TargetDevice
+
+	msg := e.Value
+	if len(msg) == 0 {
+		msg = e.Key
+	}
+	if _, ok := cur.Messages[msg]; ok || len(cur.Messages) < maxMessages {
+		cur.Messages[msg]++
+	}
+
+	return cur, toReturn
+}
+
+//record builds the count record for the bucket, nil if nothing was counted.
+func (cc counterConfig) record(b Bucket) *ci.MetricsRecord {
+	if b.Count == 0 {
+		return nil
+	}
+
+	count := b.Count
+	end := cc.interval.End(b.Start)
+	toReturn := &ci.MetricsRecord{
+		StartTime:        b.Start,
+		EndTime:          end,
+		ElapsedInSeconds: int64(end.Sub(b.Start) / time.Second),
+		RecordType:       ci.ErrorCount,
+		Building:         ci.BuildingInfo{ID: b.Target.BuildingID},
+		ErrorCount:       &count,
+		TopMessages:      topMessages(b.Messages, cc.topMessages),
+	}
+
+	switch cc.scopeKey {
+	case "deviceid":
+		toReturn.Device = ci.DeviceInfo{ID: b.Target.DeviceID}
+		toReturn.Room = ci.RoomInfo{ID: b.Target.RoomID}
+	case "roomid":
+		toReturn.Room = ci.RoomInfo{ID: b.Target.RoomID}
+	}
+
+	return toReturn
+}
+
+//topMessages returns the n most common messages, most common first.
+func topMessages(messages map[string]int, n int) []ci.MessageCount {
+	toReturn := []ci.MessageCount{}
+	for k, v := range messages {
+		toReturn = append(toReturn, ci.MessageCount{Message: k, Count: v})
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		if toReturn[i].Count != toReturn[j].Count {
+			return toReturn[i].Count > toReturn[j].Count
+		}
+		return toReturn[i].Message < toReturn[j].Message
+	})
+
+	if len(toReturn) > n {
+		toReturn = toReturn[:n]
+	}
+	return toReturn
+}
+
+//RegisterGobStructs .
+func (c *Caterpillar) RegisterGobStructs() {
+	c.GobRegisterOnce.Do(func() {
+		gob.Register(map[string]Bucket{})
+		gob.Register(time.Time{})
+	})
+}
+
+//WrapAndSend adds the device and room info to the record and sends it.
+func (c *Caterpillar) WrapAndSend(r ci.MetricsRecord) {
+	if dev, ok := c.devices[r.Device.ID]; ok {
+		r.Device = dev
+	}
+	if room, ok := c.rooms[r.Room.ID]; ok {
+		r.Room = room
+	}
+
+	log.L.Debugf("Generating %v %v for %v%v Starting %v", r.RecordType, *r.ErrorCount, r.Device.ID, r.Room.ID, r.StartTime.In(location).Format("15:04 01-02"))
+
+	c.outChan <- nydus.BulkRecordEntry{
+		Header: nydus.BulkRecordHeader{
+			Index: nydus.HeaderIndex{
+				Index: c.index,
+				Type:  "metrics",
+			},
+		},
+		Body: r,
+	}
+}
@@ -0,0 +1,65 @@
+package errorrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestCountEvent(t *testing.T) {
+	cc, err := getConfig(map[string]string{"error-keys": "communication-failure", "bucket-interval": "15m", "top-messages": "1", "scope": "roomid"})
+	if err != nil {
+		t.Fatalf("couldn't get config: %v", err.Error())
+	}
+
+	if cc.isError(events.Event{Key: "power", EventTags: []string{events.Error}}) {
+		t.Errorf("expected error-tags to be empty when error-keys are set")
+	}
+
+	dev := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	at := time.Date(2019, 3, 4, 9, 5, 0, 0, location)
+
+	cur := Bucket{}
+	for i, msg := range []string{"timeout", "refused", "timeout"} {
+		e := events.Event{Key: "communication-failure", Value: msg, Timestamp: at.Add(time.Duration(i) * time.Minute), TargetDevice: dev}
+		if !cc.isError(e) {
+			t.Fatalf("expected %v to be an error", e.Key)
+		}
+
+		next, rec := cc.countEvent(cur, e)
+		if rec != nil {
+			t.Fatalf("unexpected record within the bucket")
+		}
+		cur = next
+	}
+
+	next, rec := cc.countEvent(cur, events.Event{Key: "communication-failure", Value: "timeout", Timestamp: at.Add(20 * time.Minute), TargetDevice: dev})
+	if rec == nil {
+		t.Fatalf("expected a record for the finished bucket")
+	}
+	if *rec.ErrorCount != 3 || !rec.StartTime.Equal(time.Date(2019, 3, 4, 9, 0, 0, 0, location)) {
+		t.Errorf("expected 3 errors in the 9:00 bucket, got %v at %v", *rec.ErrorCount, rec.StartTime)
+	}
+	if len(rec.TopMessages) != 1 || rec.TopMessages[0].Message != "timeout" || rec.TopMessages[0].Count != 2 {
+		t.Errorf("unexpected top messages %v", rec.TopMessages)
+	}
+	if rec.Device.ID != "" || rec.Room.ID != "ITB-1101" {
+		t.Errorf("expected a room scoped record")
+	}
+	if next.Count != 1 {
+		t.Errorf("expected the next bucket to have 1 error")
+	}
+
+	//the day the clocks fall back is 25 hours long, 23:30 is still in its bucket.
+	cc, _ = getConfig(map[string]string{"bucket-interval": "24h"})
+	cur, _ = cc.countEvent(Bucket{}, events.Event{Key: "error", Timestamp: time.Date(2019, 11, 3, 23, 30, 0, 0, location), TargetDevice: dev})
+	_, rec = cc.countEvent(cur, events.Event{Key: "error", Timestamp: time.Date(2019, 11, 4, 0, 30, 0, 0, location), TargetDevice: dev})
+	if rec == nil || !rec.StartTime.Equal(time.Date(2019, 11, 3, 0, 0, 0, 0, location)) || !rec.EndTime.Equal(time.Date(2019, 11, 4, 0, 0, 0, 0, location)) || rec.ElapsedInSeconds != 25*60*60 {
+		t.Errorf("expected a 25 hour bucket for 2019-11-03, got %+v", rec)
+	}
+
+	if _, err := getConfig(map[string]string{"bucket-interval": "7h"}); err == nil {
+		t.Errorf("expected an error for an interval that doesn't divide a day")
+	}
+}
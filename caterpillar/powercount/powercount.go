@@ -0,0 +1,241 @@
+package powercount
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/caterpillar/corestatetime"
+	"github.com/byuoitav/caterpillar/caterpillar/timebucket"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/nydus"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//Bucket sizes
+const (
+	Hour = "hour"
+	Day  = "day"
+)
+
+var intervals = map[string]timebucket.Interval{
+	Hour: timebucket.Hour,
+	Day:  timebucket.Day,
+}
+
+//OverThresholdTag is added to records for devices that cycled more than the cycle-threshold in the bucket.
+const OverThresholdTag = "over-cycle-threshold"
+
+var location *time.Location
+
+func init() {
+	var er error
+	location, er = time.LoadLocation("America/Denver")
+	if er != nil {
+		log.L.Fatalf("Couldn't load timezone: %v", er.Error())
+	}
+}
+
+//Caterpillar counts the number of times each device is powered on in each bucket (hour or day).
+//A cycle is counted when a device goes to power on from any other power state, repeated 'on' events aren't counted.
+type Caterpillar struct {
+	outChan chan nydus.BulkRecordEntry
+	index   string
+
+	bucket    string
+	threshold int
+
+	devices map[string]ci.DeviceInfo
+	rooms   map[string]ci.RoomInfo
+
+	GobRegisterOnce sync.Once
+}
+
+//DeviceCount is a device's count in its current bucket, kept in the caterpillar's state (see timebucket). LastPower carries over between buckets.
+type DeviceCount struct {
+	Device      events.BasicDeviceInfo
+	LastPower   string
+	BucketStart time.Time
+	Count       int
+}
+
+//GetCaterpillar .
+func GetCaterpillar() (ci.Caterpillar, *nerr.E) {
+	return &Caterpillar{
+		devices: map[string]ci.DeviceInfo{},
+		rooms:   map[string]ci.RoomInfo{},
+	}, nil
+}
+
+//Run fulfils the Caterpillar interface.
+func (c *Caterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, cnfg config.Caterpillar, GetData func(int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
+	index, ok := cnfg.TypeConfig["output-index"]
+	if !ok {
+		return state, nerr.Create(fmt.Sprintf("Missing config item for Caterpillar type %v. Need output-index", cnfg.Type), "invalid-config")
+	}
+
+	c.index = index
+	c.outChan = outChan
+
+	var err *nerr.E
+	c.bucket, c.threshold, err = getConfig(cnfg.TypeConfig)
+	if err != nil {
+		return state, err.Addf("Couldn't run power count caterpillar %v", id)
+	}
+
+	c.devices, c.rooms, err = corestatetime.GetDeviceAndRoomInfo(cnfg.TypeConfig["inventory"])
+	if err != nil {
+		return state, err.Addf("Couldn't run power count caterpillar %v", id)
+	}
+
+	counts := map[string]DeviceCount{}
+	if v, ok := state.Data.(map[string]DeviceCount); ok {
+		counts = v
+	}
+
+	inchan, err := GetData(1000)
+	if err != nil {
+		return state, err.Addf("Couldn't run power count caterpillar %v", id)
+	}
+
+	lastTime := state.LastEventTime
+	for i := range inchan {
+		e, ok := i.(events.Event)
+		if !ok {
+			log.L.Warnf("Unkown type in channel %v", i)
+			continue
+		}
+		lastTime = e.Timestamp
+
+		if e.Key != "power" || len(e.TargetDevice.DeviceID) == 0 {
+			continue
+		}
+
+		cur, rec := countEvent(counts[e.TargetDevice.DeviceID], e, c.bucket)
+		counts[e.TargetDevice.DeviceID] = cur
+		if rec != nil {
+			c.WrapAndSend(*rec)
+		}
+	}
+
+	for k, v := range counts {
+		if v.BucketStart.IsZero() || !intervals[c.bucket].Ended(v.BucketStart, lastTime) {
+			continue
+		}
+		if rec := v.record(c.bucket); rec != nil {
+			c.WrapAndSend(*rec)
+		}
+		v.BucketStart = time.Time{}
+		v.Count = 0
+		counts[k] = v
+	}
+
+	return config.State{
+		LastEventTime: lastTime,
+		Data:          counts,
+	}, nil
+}
+
+func getConfig(typeConfig map[string]string) (string, int, *nerr.E) {
+	bucket := Day
+	if v, ok := typeConfig["bucket"]; ok && len(v) > 0 {
+		if v != Hour && v != Day {
+			return "", 0, nerr.Create(fmt.Sprintf("Invalid bucket %v, must be %v or %v", v, Hour, Day), "invalid-config")
+		}
+		bucket = v
+	}
+
+	threshold := 0
+	if v, ok := typeConfig["cycle-threshold"]; ok && len(v) > 0 {
+		var err error
+		threshold, err = strconv.Atoi(v)
+		if err != nil || threshold < 0 {
+			return "", 0, nerr.Create(fmt.Sprintf("Invalid cycle-threshold %v, must be a positive number", v), "invalid-config")
+		}
+	}
+
+	return bucket, threshold, nil
+}
+
+//countEvent adds a power event to the device's count. If the event falls in a new bucket the record for the finished bucket is returned.
+func countEvent(cur DeviceCount, e events.Event, bucket string) (DeviceCount, *ci.MetricsRecord) {
+	var toReturn *ci.MetricsRecord
+
+	start := intervals[bucket].Start(e.Timestamp)
+	if !cur.BucketStart.Equal(start) {
+		if !cur.BucketStart.IsZero() {
+			toReturn = cur.record(bucket)
+		}
+		cur.BucketStart = start
+		cur.Count = 0
+	}
+
+	if e.Value == "on" && cur.LastPower != "on" {
+		cur.Count++
+	}
+	cur.LastPower = e.Value
+	cur.Device = e.TargetDevice
+
+	return cur, toReturn
+}
+
+//record builds the count record for the bucket, nil if nothing was counted.
+func (d DeviceCount) record(bucket string) *ci.MetricsRecord {
+	if d.Count == 0 {
+		return nil
+	}
+
+	count := d.Count
+	end := intervals[bucket].End(d.BucketStart)
+	return &ci.MetricsRecord{
+		StartTime:        d.BucketStart,
+		EndTime:          end,
+		ElapsedInSeconds: int64(end.Sub(d.BucketStart) / time.Second),
+		RecordType:       ci.PowerCount,
+		Device:           ci.DeviceInfo{ID: d.Device.DeviceID},
+		Room:             ci.RoomInfo{ID: d.Device.RoomID},
+		Building:         ci.BuildingInfo{ID: d.Device.BuildingID},
+		PowerCount:       &count,
+	}
+}
+
+//RegisterGobStructs .
+func (c *Caterpillar) RegisterGobStructs() {
+	c.GobRegisterOnce.Do(func() {
+		gob.Register(map[string]DeviceCount{})
+		gob.Register(time.Time{})
+	})
+}
+
+//WrapAndSend adds the device and room info to the record, flags it if it's over the threshold, and sends it.
+func (c *Caterpillar) WrapAndSend(r ci.MetricsRecord) {
+	if dev, ok := c.devices[r.Device.ID]; ok {
+		r.Device = dev
+	} else {
+		log.L.Warnf("Unkown device %v in power count", r.Device.ID)
+	}
+	if room, ok := c.rooms[r.Room.ID]; ok {
+		r.Room = room
+	}
+
+	if c.threshold > 0 && r.PowerCount != nil && *r.PowerCount > c.threshold {
+		r.Tags = append(r.Tags, OverThresholdTag)
+	}
+
+	log.L.Debugf("Generating %v %v for %v Starting %v", r.RecordType, *r.PowerCount, r.Device.ID, r.StartTime.In(location).Format("15:04 01-02"))
+
+	c.outChan <- nydus.BulkRecordEntry{
+		Header: nydus.BulkRecordHeader{
+			Index: nydus.HeaderIndex{
+				Index: c.index,
+				Type:  "metrics",
+			},
+		},
+		Body: r,
+	}
+}
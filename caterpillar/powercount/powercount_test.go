@@ -0,0 +1,69 @@
+package powercount
+
+import (
+	"testing"
+	"time"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestCountEvent(t *testing.T) {
+	dev := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	day := time.Date(2019, 3, 4, 8, 0, 0, 0, location)
+
+	evs := []struct {
+		value string
+		at    time.Time
+	}{
+		{"on", day},
+		{"on", day.Add(10 * time.Minute)}, //repeated on isn't a cycle
+		{"standby", day.Add(time.Hour)},
+		{"on", day.Add(2 * time.Hour)},
+		{"standby", day.Add(26 * time.Hour)}, //next day
+	}
+
+	cur := DeviceCount{}
+	for i, v := range evs {
+		next, rec := countEvent(cur, events.Event{Key: "power", Value: v.value, Timestamp: v.at, TargetDevice: dev}, Day)
+		cur = next
+
+		if i < len(evs)-1 {
+			if rec != nil {
+				t.Fatalf("unexpected record after event %v", i)
+			}
+			continue
+		}
+
+		if rec == nil {
+			t.Fatalf("expected a record for the finished day")
+		}
+		if *rec.PowerCount != 2 {
+			t.Errorf("expected 2 cycles, got %v", *rec.PowerCount)
+		}
+		if !rec.StartTime.Equal(time.Date(2019, 3, 4, 0, 0, 0, 0, location)) || rec.ElapsedInSeconds != 24*60*60 {
+			t.Errorf("unexpected bucket %v (%v seconds)", rec.StartTime, rec.ElapsedInSeconds)
+		}
+		if rec.Building.ID != "ITB" || rec.Room.ID != "ITB-1101" {
+			t.Errorf("missing room and building on the record")
+		}
+	}
+
+	if cur.Count != 0 || !cur.BucketStart.Equal(time.Date(2019, 3, 5, 0, 0, 0, 0, location)) {
+		t.Errorf("expected an empty count for the next day, got %+v", cur)
+	}
+
+	//both 1:00 hours on the day the clocks fall back get their own bucket.
+	first := time.Date(2019, 11, 3, 1, 30, 0, 0, location)
+	cur, _ = countEvent(DeviceCount{}, events.Event{Key: "power", Value: "on", Timestamp: first, TargetDevice: dev}, Hour)
+	_, rec := countEvent(cur, events.Event{Key: "power", Value: "on", Timestamp: first.Add(time.Hour), TargetDevice: dev}, Hour)
+	if rec == nil || rec.ElapsedInSeconds != 60*60 || !rec.EndTime.Equal(first.Add(30*time.Minute)) {
+		t.Errorf("expected a record for the first 1:00 hour, got %+v", rec)
+	}
+
+	if b, _, _ := getConfig(map[string]string{"bucket": "hour"}); b != Hour {
+		t.Errorf("expected hour buckets")
+	}
+	if _, _, err := getConfig(map[string]string{"bucket": "week"}); err == nil {
+		t.Errorf("expected an error for an unknown bucket")
+	}
+}
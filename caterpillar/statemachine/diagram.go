@@ -0,0 +1,282 @@
+package statemachine
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+)
+
+//Diagram formats
+const (
+	Dot     = "dot"
+	SVG     = "svg"
+	Mermaid = "mmd"
+)
+
+//ContentTypes maps each diagram format to the content type it should be served with.
+var ContentTypes = map[string]string{
+	Dot:     "text/vnd.graphviz; charset=utf-8",
+	SVG:     "image/svg+xml",
+	Mermaid: "text/plain; charset=utf-8",
+}
+
+//Render draws the machine in the format requested. If counts isn't nil, each node is labeled with its count, see NodeCounts.
+//Rendering SVG requires the graphviz dot binary to be installed.
+func (m *Machine) Render(format string, counts map[string]int) ([]byte, *nerr.E) {
+	switch format {
+	case Dot:
+		d, err := m.GetDot(counts)
+		return []byte(d), err
+	case SVG:
+		d, err := m.GetDot(counts)
+		if err != nil {
+			return []byte{}, err.Addf("Couldn't render svg")
+		}
+		return renderSVG(d)
+	case Mermaid:
+		return []byte(m.GetMermaid(counts)), nil
+	}
+
+	return []byte{}, nerr.Create(fmt.Sprintf("Unkown diagram format %v. Must be one of %v, %v, or %v", format, Dot, SVG, Mermaid), "invalid-format")
+}
+
+//NodeCounts returns the number of scopes sitting in each node. Parent nodes include the counts of their children.
+func (m *Machine) NodeCounts() map[string]int {
+	toReturn := map[string]int{}
+
+	for _, s := range m.CurStates {
+		for _, a := range ancestors(m.Nodes, s.CurNode) {
+			toReturn[a]++
+		}
+	}
+
+	return toReturn
+}
+
+//GetDot builds a graphviz dot graph of the machine. Exits, actions, and enters are drawn as boxes along each transition, and parent nodes are drawn as clusters around their children.
+func (m *Machine) GetDot(counts map[string]int) (string, *nerr.E) {
+	graph := gographviz.NewGraph()
+	graph.SetName("Machines")
+	graph.SetDir(true)
+
+	ids := m.sortedNodeIDs()
+
+	//each parent gets a cluster, nested inside of its own parent's cluster.
+	parents := map[string]bool{}
+	for _, id := range ids {
+		if len(m.Nodes[id].Parent) > 0 {
+			parents[m.Nodes[id].Parent] = true
+		}
+	}
+	for _, id := range ids {
+		if !parents[id] {
+			continue
+		}
+		err := graph.AddSubGraph(dotParent(m.Nodes, m.Nodes[id].Parent), "cluster_"+id, map[string]string{
+			"label": fmt.Sprintf("\"%v\"", id),
+			"style": "dashed",
+		})
+		if err != nil {
+			log.L.Errorf("%v", err.Error())
+			return "", nerr.Translate(err)
+		}
+	}
+
+	for _, id := range ids {
+		n := m.Nodes[id]
+
+		attrs := map[string]string{
+			"shape":     "octagon",
+			"color":     "\"#e53935\"",
+			"fontcolor": "\"#e53935\"",
+		}
+		if parents[id] {
+			attrs["shape"] = "folder"
+		}
+		if counts != nil {
+			attrs["label"] = fmt.Sprintf("\"%v (%v)\"", id, counts[id])
+		}
+
+		parent := dotParent(m.Nodes, n.Parent)
+		if parents[id] {
+			parent = "cluster_" + id
+		}
+
+		err := graph.AddNode(parent, n.ID, attrs)
+		if err != nil {
+			log.L.Errorf("%v", err.Error())
+			return "", nerr.Translate(err)
+		}
+
+		for j, t := range n.Transitions {
+			pid := strconv.Itoa(j) //pathid, grows as it moves
+			//add a node for this exit (if any)
+			name, err := AddExit(n, pid, t, graph)
+			if err != nil {
+				return "", err
+			}
+			//now we add one for each action
+			for k, a := range t.Actions {
+
+				pid += strconv.Itoa(k)
+				name, err = AddAction(n, name, pid, t, a, graph, name == n.ID)
+				if err != nil {
+					return "", err
+				}
+			}
+			//now we check to see if there's an entry node for our destination
+			_, err = AddEntry(n, m.Nodes[t.Destination], name, pid, t, graph, name == n.ID)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if _, ok := m.Nodes[m.StartNode]; ok {
+		graph.AddNode("Machines", "__start", map[string]string{"shape": "point"})
+		graph.AddEdge("__start", m.StartNode, true, nil)
+	}
+
+	return graph.String(), nil
+}
+
+//GetMermaid builds a mermaid state diagram of the machine. Transition labels include the trigger, any guard, and the actions run.
+func (m *Machine) GetMermaid(counts map[string]int) string {
+	b := &strings.Builder{}
+	b.WriteString("stateDiagram-v2\n")
+
+	children := map[string][]string{}
+	ids := m.sortedNodeIDs()
+	for _, id := range ids {
+		p := m.Nodes[id].Parent
+		if _, ok := m.Nodes[p]; ok {
+			children[p] = append(children[p], id)
+		}
+	}
+
+	var writeNode func(id, indent string)
+	writeNode = func(id, indent string) {
+		label := id
+		if counts != nil {
+			label = fmt.Sprintf("%v (%v)", id, counts[id])
+		}
+
+		if len(children[id]) == 0 {
+			fmt.Fprintf(b, "%vstate \"%v\" as %v\n", indent, label, mermaidID(id))
+			return
+		}
+
+		fmt.Fprintf(b, "%vstate %v {\n", indent, mermaidID(id))
+		if len(m.Nodes[id].Initial) > 0 {
+			fmt.Fprintf(b, "%v    [*] --> %v\n", indent, mermaidID(m.Nodes[id].Initial))
+		}
+		for _, c := range children[id] {
+			writeNode(c, indent+"    ")
+		}
+		fmt.Fprintf(b, "%v}\n", indent)
+		if counts != nil {
+			fmt.Fprintf(b, "%vnote right of %v : %v\n", indent, mermaidID(id), label)
+		}
+	}
+
+	for _, id := range ids {
+		if _, ok := m.Nodes[m.Nodes[id].Parent]; !ok {
+			writeNode(id, "    ")
+		}
+	}
+
+	if _, ok := m.Nodes[m.StartNode]; ok {
+		fmt.Fprintf(b, "    [*] --> %v\n", mermaidID(m.StartNode))
+	}
+
+	for _, id := range ids {
+		for _, t := range m.Nodes[id].Transitions {
+			label := fmt.Sprintf("%v = %v", t.TriggerKey, t.TriggerValue)
+			if t.TriggerValue == nil {
+				label = fmt.Sprintf("%v = *", t.TriggerKey)
+			} else if v, ok := t.TriggerValue.(TransitionStoreValue); ok {
+				label = fmt.Sprintf("%v = store[%v]", t.TriggerKey, v.StoreValue)
+			}
+
+			if t.Guard != nil {
+				label += fmt.Sprintf(" [%v]", funcName(t.Guard))
+			}
+			if len(t.Actions) > 0 {
+				names := []string{}
+				for _, a := range t.Actions {
+					names = append(names, funcName(a))
+				}
+				label += " / " + strings.Join(names, ", ")
+			}
+			if t.Internal {
+				label += " (internal)"
+			}
+
+			//mermaid uses colons to split the label off
+			label = strings.Replace(label, ":", "#58;", -1)
+			fmt.Fprintf(b, "    %v --> %v : %v\n", mermaidID(id), mermaidID(t.Destination), label)
+		}
+	}
+
+	return b.String()
+}
+
+func (m *Machine) sortedNodeIDs() []string {
+	ids := []string{}
+	for k := range m.Nodes {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+//dotParent returns the graph a node with the given parent should be added to.
+func dotParent(nodes map[string]Node, parent string) string {
+	if _, ok := nodes[parent]; ok {
+		return "cluster_" + parent
+	}
+	return "Machines"
+}
+
+//mermaidID makes a node id safe to use as a mermaid state id.
+func mermaidID(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+//funcName gets the short name of a function for labeling.
+func funcName(f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+func renderSVG(dot string) ([]byte, *nerr.E) {
+	cmd := exec.Command("dot", "-Tsvg")
+	cmd.Stdin = strings.NewReader(dot)
+
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return []byte{}, nerr.Translate(err).Addf("Couldn't render svg with graphviz: %s", stderr.Bytes())
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package statemachine
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+//ExpireEventKey is the key of the event passed to exits when a state is finalized on expiry.
+const ExpireEventKey = "expire"
+
+//RunEndEventKey is the key of the event sent to every state at the end of a run, see EndRun.
+const RunEndEventKey = "run-end"
+
+//Expiry controls when stored scope states are thrown away.
+type Expiry struct {
+	After    time.Duration //states with no events for this long are expired, 0 means never.
+	Finalize bool          //if true, the exits of the current node are run before the state is removed, so the time spent in it is recorded.
+}
+
+//GetExpiry reads the expiry settings out of a caterpillar's type-config:
+//state-expiry-days is how many days without an event before a state expires, state-expiry-action is either drop (the default) or finalize.
+func GetExpiry(typeConfig map[string]string) (Expiry, *nerr.E) {
+	toReturn := Expiry{}
+
+	if v, ok := typeConfig["state-expiry-days"]; ok && len(v) > 0 {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return toReturn, nerr.Create(fmt.Sprintf("Invalid state-expiry-days %v, must be a positive number of days", v), "invalid-config")
+		}
+		toReturn.After = time.Duration(days) * 24 * time.Hour
+	}
+
+	switch typeConfig["state-expiry-action"] {
+	case "", "drop":
+	case "finalize":
+		toReturn.Finalize = true
+	default:
+		return toReturn, nerr.Create(fmt.Sprintf("Invalid state-expiry-action %v, must be drop or finalize", typeConfig["state-expiry-action"]), "invalid-config")
+	}
+
+	return toReturn, nil
+}
+
+//Expire removes the states that haven't had an event since now minus ex.After, along with any that keep returns false for (e.g. devices that have been deleted).
+//keep may be nil. When finalizing, the exits are run with an event keyed ExpireEventKey, at the cutoff for stale states and at now for the rest, so the time in the
+//current node is recorded up to then. Returns the number of states removed.
+func (m *Machine) Expire(ex Expiry, now time.Time, keep func(scope string) bool) int {
+	cutoff := time.Time{}
+	if ex.After > 0 {
+		cutoff = now.Add(-1 * ex.After)
+	}
+
+	removed := 0
+	for k, cur := range m.CurStates {
+		stale := !cutoff.IsZero() && cur.LastEvent.Before(cutoff)
+		if !stale && (keep == nil || keep(k)) {
+			continue
+		}
+
+		if ex.Finalize {
+			at := now
+			if stale {
+				at = cutoff
+			}
+			m.finalize(k, cur, at)
+		}
+
+		log.L.Debugf("Expiring state of %v in machine %v, last event at %v", k, m.Name, cur.LastEvent)
+		delete(m.CurStates, k)
+		removed++
+	}
+
+	if removed > 0 {
+		log.L.Infof("Expired %v states from machine %v", removed, m.Name)
+	}
+	return removed
+}
+
+//EndRun sends an event keyed RunEndEventKey at the given time to every state, so machines can close out time that's built up without any events
+//(e.g. a device that's stopped sending heartbeats). It doesn't count as an event for expiry.
+func (m *Machine) EndRun(at time.Time) {
+	for k, cur := range m.CurStates {
+		last, target := cur.LastEvent, cur.LastTarget
+
+		e := events.Event{
+			Key:          RunEndEventKey,
+			Timestamp:    at,
+			TargetDevice: cur.LastTarget,
+		}
+		//states from before the last target was kept can't be addressed.
+		if scope, _ := GetScope(m.ScopeKey, e); scope != k {
+			continue
+		}
+		if err := m.ProcessEvent(e); err != nil {
+			log.L.Warnf("Couldn't end run for %v in machine %v: %v", k, m.Name, err.Error())
+		}
+
+		cur.LastEvent, cur.LastTarget = last, target
+	}
+}
+
+//finalize runs the exits from the current node out at the given time, so any records being built up are sent.
+func (m *Machine) finalize(scope string, cur *MachineState, at time.Time) {
+	e := events.Event{
+		Key:          ExpireEventKey,
+		Timestamp:    at,
+		TargetDevice: cur.LastTarget,
+	}
+
+	for _, id := range ancestors(m.Nodes, cur.CurNode) {
+		if m.Nodes[id].Exit == nil {
+			continue
+		}
+
+		records, err := m.Nodes[id].Exit(cur.ValueStore, e)
+		if err != nil {
+			log.L.Warnf("Couldn't finalize state of %v in node %v: %v", scope, id, err.Error())
+			continue
+		}
+		for i := range records {
+			m.Caterpillar.WrapAndSend(records[i])
+		}
+	}
+}
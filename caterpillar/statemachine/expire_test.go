@@ -0,0 +1,85 @@
+package statemachine
+
+import (
+	"testing"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+type recordingCaterpillar struct {
+	nopCaterpillar
+	records *[]ci.MetricsRecord
+}
+
+func (r recordingCaterpillar) WrapAndSend(rec ci.MetricsRecord) {
+	*r.records = append(*r.records, rec)
+}
+
+func TestExpire(t *testing.T) {
+	records := []ci.MetricsRecord{}
+	exit := func(state map[string]interface{}, e events.Event) ([]ci.MetricsRecord, *nerr.E) {
+		return []ci.MetricsRecord{{RecordType: e.Key, EndTime: e.Timestamp, Device: ci.DeviceInfo{ID: e.TargetDevice.DeviceID}}}, nil
+	}
+
+	nodes := map[string]Node{
+		"start": Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", TriggerValue: "on", Destination: "on"}}},
+		"on":    Node{ID: "on", Exit: exit, Transitions: []Transition{{TriggerKey: "power", TriggerValue: "standby", Destination: "start"}}},
+	}
+
+	m, err := BuildStateMachine("deviceid", nodes, "start", config.State{}, recordingCaterpillar{records: &records})
+	if err != nil {
+		t.Fatalf("couldn't build machine: %v", err.Error())
+	}
+
+	now := time.Now()
+	for _, d := range []struct {
+		id   string
+		last time.Time
+	}{
+		{"ITB-1101-D1", now.Add(-40 * 24 * time.Hour)},
+		{"ITB-1101-D2", now.Add(-1 * time.Hour)},
+		{"ITB-1101-D3", now.Add(-1 * time.Hour)},
+	} {
+		e := events.Event{Key: "power", Value: "on", Timestamp: d.last, TargetDevice: events.BasicDeviceInfo{DeviceID: d.id}}
+		if err := m.ProcessEvent(e); err != nil {
+			t.Fatalf("couldn't process event: %v", err.Error())
+		}
+	}
+
+	ex, err := GetExpiry(map[string]string{"state-expiry-days": "30", "state-expiry-action": "finalize"})
+	if err != nil {
+		t.Fatalf("couldn't get expiry: %v", err.Error())
+	}
+
+	//D3 has been deleted
+	removed := m.Expire(ex, now, func(k string) bool { return k != "ITB-1101-D3" })
+	if removed != 2 {
+		t.Errorf("expected 2 states removed, got %v", removed)
+	}
+	if _, ok := m.CurStates["ITB-1101-D2"]; !ok || len(m.CurStates) != 1 {
+		t.Errorf("expected only ITB-1101-D2 to be left, have %v", m.CurStates)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 closing records, got %v", len(records))
+	}
+	for _, r := range records {
+		if r.RecordType != ExpireEventKey {
+			t.Errorf("expected closing record from an %v event, got %v", ExpireEventKey, r.RecordType)
+		}
+		if r.Device.ID == "ITB-1101-D1" && !r.EndTime.Equal(now.Add(-30*24*time.Hour)) {
+			t.Errorf("expected the stale state's closing record to end at the cutoff, ended at %v", r.EndTime)
+		}
+		if r.Device.ID == "ITB-1101-D3" && !r.EndTime.Equal(now) {
+			t.Errorf("expected the deleted device's closing record to end at the end of the run, ended at %v", r.EndTime)
+		}
+	}
+
+	if _, err := GetExpiry(map[string]string{"state-expiry-action": "delete"}); err == nil {
+		t.Errorf("expected an error for an unknown expiry action")
+	}
+}
@@ -23,103 +23,121 @@ func (m *Machine) ProcessEvent(e events.Event) *nerr.E {
 	cur, ok := m.CurStates[k]
 	if !ok {
 		tmp := MachineState{
-			CurNode:    m.StartNode,
+			CurNode:    resolveInitial(m.Nodes, m.StartNode),
 			ValueStore: map[string]interface{}{},
 		}
 		cur = &tmp
 		m.CurStates[k] = cur
 	}
+	cur.LastEvent = e.Timestamp
+	cur.LastTarget = e.TargetDevice
 
 	log.L.Debugf("Current state %v", cur.CurNode)
 	log.L.Debugf("Processing event %v, %v, %v, %v", k, e.Key, e.Value, e.Timestamp.In(location).Format("15:04:05 01-02"))
-	//check the transitions from the current state of m
-	curNode, ok := m.Nodes[cur.CurNode]
-	if !ok {
-		return nerr.Create("unkown current node: %v", cur.CurNode)
+	//check the transitions from the current state of m, then from each of the nodes it's nested inside of
+	if _, ok := m.Nodes[cur.CurNode]; !ok {
+		return nerr.Create(fmt.Sprintf("unkown current node: %v", cur.CurNode), "invalid-state")
 	}
 
-	for i, t := range curNode.Transitions {
-		if e.Key != t.TriggerKey {
-			continue
-		}
+	for _, owner := range ancestors(m.Nodes, cur.CurNode) {
+		curNode := m.Nodes[owner]
+
+		for i, t := range curNode.Transitions {
+			if e.Key != t.TriggerKey {
+				continue
+			}
 
-		//check to see if we need to match on a value
-		if t.TriggerValue != nil {
-			//check the value we need to match on
-			if v, ok := t.TriggerValue.(TransitionStoreValue); ok {
-				//get the field from the storea
-				if checkValue, ok := cur.ValueStore[v.StoreValue]; ok {
+			//check to see if we need to match on a value
+			if t.TriggerValue != nil {
+				//check the value we need to match on
+				if v, ok := t.TriggerValue.(TransitionStoreValue); ok {
+					//get the field from the storea
+					checkValue, ok := cur.ValueStore[v.StoreValue]
+					if !ok {
+						//nothing in the store? Error or continue.
+						log.L.Errorf("No value of name %v stored", v.StoreValue)
+						continue
+					}
 					//assert that checkValue is a string, if not, we coerce it
 					valueString, ok := checkValue.(string)
 					if !ok {
-						valueString = fmt.Sprintf("%v", valueString)
+						valueString = fmt.Sprintf("%v", checkValue)
 					}
 					if e.Value != valueString {
 						continue
 					}
-					//we transition
-					m.transition(e, t, cur)
-
-				} else {
-					//nothing in the store? Error or continue.
-					log.L.Errorf("No value of name %v stored", v.StoreValue)
-					continue
-				}
-			} else if v, ok := t.TriggerValue.(string); ok {
-				if e.Value != v {
-					continue
-				}
-				if len(t.ID) > 0 {
-					log.L.Debugf("Transitioning on %v", t.ID)
-				} else {
-					log.L.Debugf("Transitioning on transition %v from state %v", i, curNode.ID)
-				}
-
-				log.L.Debugf("Starting transition.")
-				err := m.transition(e, t, cur)
-				log.L.Debugf("Back from transition")
-				if err != nil {
-					if len(t.ID) > 0 {
-						err = err.Addf("Error with transition %v", t.ID)
-					} else {
-						err = err.Addf("Error with transition number %v for state %v", i, curNode.ID)
+				} else if v, ok := t.TriggerValue.(string); ok {
+					if e.Value != v {
+						continue
 					}
-					log.L.Errorf("%v", err.Error())
-					return err
+				} else {
+					log.L.Errorf("Unkown triggerValue %v", t.TriggerValue)
+					return nerr.Create(fmt.Sprintf("INvalid TriggerValue on transition %v", t), "invalid-config")
 				}
+			}
 
-				return nil
+			if t.Guard != nil && !t.Guard(cur.ValueStore, e) {
+				continue
+			}
 
+			if len(t.ID) > 0 {
+				log.L.Debugf("Transitioning on %v", t.ID)
 			} else {
-				log.L.Errorf("Unkown triggerValue %v", t.TriggerValue)
-				return nerr.Create(fmt.Sprintf("INvalid TriggerValue on transition %v", t), "invalid-config")
+				log.L.Debugf("Transitioning on transition %v from state %v", i, curNode.ID)
+			}
+
+			//the first matching transition is the only one taken.
+			log.L.Debugf("Starting transition.")
+			err := m.transition(e, t, cur)
+			log.L.Debugf("Back from transition")
+			if err != nil {
+				if len(t.ID) > 0 {
+					err = err.Addf("Error with transition %v", t.ID)
+				} else {
+					err = err.Addf("Error with transition number %v for state %v", i, curNode.ID)
+				}
+				log.L.Errorf("%v", err.Error())
+				return err
 			}
-		}
-		//otherwise we transition
-		m.transition(e, t, cur)
 
+			return nil
+		}
 	}
 
 	return nil
 }
 
-//transition
+//transition runs the exits from the current node out to the common parent of the destination, then the actions, then the enters down into the destination.
 func (m *Machine) transition(e events.Event, t Transition, CurState *MachineState) *nerr.E {
 
-	internal := t.Internal && t.Destination == CurState.CurNode
+	//an internal transition targeting the current node, or one of the nodes it's nested in, stays put.
+	internal := t.Internal && isAncestor(m.Nodes, t.Destination, CurState.CurNode)
 	if internal {
 		log.L.Debugf("Internal transition")
 	}
 
-	log.L.Debugf("Running external transition")
-	//do node exit
-	if m.Nodes[CurState.CurNode].Exit != nil && !internal {
-		records, err := m.Nodes[CurState.CurNode].Exit(CurState.ValueStore, e)
+	dst := resolveInitial(m.Nodes, t.Destination)
+	if _, ok := m.Nodes[dst]; !ok {
+		return nerr.Create(fmt.Sprintf("unkown destination node: %v", dst), "invalid-config")
+	}
+
+	exits, enters := []string{}, []string{}
+	if !internal {
+		log.L.Debugf("Running external transition")
+		exits, enters = transitionPath(m.Nodes, CurState.CurNode, dst)
+	}
+
+	//do node exits, innermost first
+	for _, id := range exits {
+		if m.Nodes[id].Exit == nil {
+			continue
+		}
+		records, err := m.Nodes[id].Exit(CurState.ValueStore, e)
 		if err != nil {
 			err.Add("Couldn't generate record")
 			return err
 		}
-		log.L.Debugf("Exit generated %v records", len(records))
+		log.L.Debugf("Exit of %v generated %v records", id, len(records))
 		for i := range records {
 			m.Caterpillar.WrapAndSend(records[i])
 		}
@@ -137,9 +155,13 @@ func (m *Machine) transition(e events.Event, t Transition, CurState *MachineStat
 		}
 	}
 	log.L.Debugf("Done with actions.")
-	if m.Nodes[t.Destination].Enter != nil && !internal {
-		//do node enter
-		records, err := m.Nodes[t.Destination].Enter(CurState.ValueStore, e)
+
+	//do node enters, outermost first
+	for _, id := range enters {
+		if m.Nodes[id].Enter == nil {
+			continue
+		}
+		records, err := m.Nodes[id].Enter(CurState.ValueStore, e)
 		if err != nil {
 			err.Add("Couldn't generate record")
 			return err
@@ -150,8 +172,13 @@ func (m *Machine) transition(e events.Event, t Transition, CurState *MachineStat
 	}
 	log.L.Debugf("Done with enter.")
 
-	//set currentnodea
-	CurState.CurNode = t.Destination
+	//set currentnode
+	if !internal {
+		if m.OnTransition != nil {
+			m.OnTransition(m.Name, CurState.CurNode, dst)
+		}
+		CurState.CurNode = dst
+	}
 
 	return nil
 }
@@ -0,0 +1,100 @@
+package statemachine
+
+//ancestors returns the chain of nodes from id up through each of its parents, starting with id itself.
+//It stops if a parent is undefined or the chain loops back on itself.
+func ancestors(nodes map[string]Node, id string) []string {
+	toReturn := []string{}
+	seen := map[string]bool{}
+
+	for len(id) > 0 && !seen[id] {
+		n, ok := nodes[id]
+		if !ok {
+			break
+		}
+
+		seen[id] = true
+		toReturn = append(toReturn, id)
+		id = n.Parent
+	}
+
+	return toReturn
+}
+
+//isAncestor returns true if ancestor is id or one of id's parents.
+func isAncestor(nodes map[string]Node, ancestor, id string) bool {
+	for _, a := range ancestors(nodes, id) {
+		if a == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+//resolveInitial follows the Initial child of a parent node down to the node the machine will actually sit in.
+func resolveInitial(nodes map[string]Node, id string) string {
+	seen := map[string]bool{}
+
+	for !seen[id] {
+		seen[id] = true
+
+		n, ok := nodes[id]
+		if !ok || len(n.Initial) == 0 {
+			return id
+		}
+		id = n.Initial
+	}
+
+	return id
+}
+
+//transitionPath returns the nodes to exit (innermost first) and the nodes to enter (outermost first) when moving from src to dst.
+//Nodes that contain both src and dst are left alone, unless one contains the other, in which case the containing node is exited and entered again.
+func transitionPath(nodes map[string]Node, src, dst string) ([]string, []string) {
+	srcChain := ancestors(nodes, src)
+	dstChain := ancestors(nodes, dst)
+
+	inDst := map[string]bool{}
+	for _, id := range dstChain {
+		inDst[id] = true
+	}
+
+	//find the closest common ancestor
+	common := ""
+	for _, id := range srcChain {
+		if inDst[id] {
+			common = id
+			break
+		}
+	}
+
+	if common == src || common == dst {
+		common = nodes[common].Parent
+	}
+
+	exits := []string{}
+	for _, id := range srcChain {
+		if id == common {
+			break
+		}
+		exits = append(exits, id)
+	}
+
+	enters := []string{}
+	for _, id := range dstChain {
+		if id == common {
+			break
+		}
+		enters = append([]string{id}, enters...)
+	}
+
+	return exits, enters
+}
+
+//effectiveTransitions returns the transitions that apply when the machine sits in id: its own, followed by those of each parent.
+func effectiveTransitions(nodes map[string]Node, id string) []Transition {
+	toReturn := []Transition{}
+	for _, a := range ancestors(nodes, id) {
+		toReturn = append(toReturn, nodes[a].Transitions...)
+	}
+	return toReturn
+}
@@ -0,0 +1,123 @@
+package statemachine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/nydus"
+	"github.com/byuoitav/common/nerr"
+	"github.com/byuoitav/common/v2/events"
+)
+
+type nopCaterpillar struct{}
+
+func (n nopCaterpillar) Run(id string, recordCount int, state config.State, outChan chan nydus.BulkRecordEntry, c config.Caterpillar, GetData func(cap int) (chan interface{}, *nerr.E)) (config.State, *nerr.E) {
+	return state, nil
+}
+func (n nopCaterpillar) RegisterGobStructs()            {}
+func (n nopCaterpillar) WrapAndSend(r ci.MetricsRecord) {}
+
+func TestHierarchicalTransitions(t *testing.T) {
+	calls := []string{}
+	hook := func(name string) func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E) {
+		return func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E) {
+			calls = append(calls, name)
+			return []ci.MetricsRecord{}, nil
+		}
+	}
+
+	nodes := map[string]Node{
+		"start": Node{ID: "start", Transitions: []Transition{
+			{TriggerKey: "power", TriggerValue: "on", Destination: "powered"},
+		}},
+		"powered": Node{ID: "powered", Initial: "on", Enter: hook("enter powered"), Exit: hook("exit powered"), Transitions: []Transition{
+			{TriggerKey: "power", TriggerValue: "standby", Destination: "start", Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){hook("action off")}},
+			{TriggerKey: "input", Destination: "powered", Internal: true, Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){hook("action input")}},
+		}},
+		"on": Node{ID: "on", Parent: "powered", Enter: hook("enter on"), Exit: hook("exit on"), Transitions: []Transition{
+			{TriggerKey: "blanked", TriggerValue: "true", Destination: "blank"},
+		}},
+		"blank": Node{ID: "blank", Parent: "powered", Enter: hook("enter blank"), Exit: hook("exit blank"), Transitions: []Transition{
+			{TriggerKey: "blanked", TriggerValue: "false", Destination: "on"},
+			{TriggerKey: "power", TriggerValue: "standby", Destination: "blank", Internal: true, Actions: []func(map[string]interface{}, events.Event) ([]ci.MetricsRecord, *nerr.E){hook("action ignore standby")}},
+		}},
+	}
+
+	m, err := BuildStateMachine("deviceid", nodes, "start", config.State{}, nopCaterpillar{})
+	if err != nil {
+		t.Fatalf("couldn't build machine: %v", err.Error())
+	}
+
+	steps := []struct {
+		key, value string
+		node       string
+		calls      []string
+	}{
+		{"power", "on", "on", []string{"enter powered", "enter on"}},
+		{"input", "hdmi1", "on", []string{"action input"}},
+		{"blanked", "true", "blank", []string{"exit on", "enter blank"}},
+		{"power", "standby", "blank", []string{"action ignore standby"}},
+		{"blanked", "false", "on", []string{"exit blank", "enter on"}},
+		{"power", "standby", "start", []string{"exit on", "exit powered", "action off"}},
+	}
+
+	for i, s := range steps {
+		calls = []string{}
+		e := events.Event{
+			Key:          s.key,
+			Value:        s.value,
+			Timestamp:    time.Now(),
+			TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D1"},
+		}
+
+		if err := m.ProcessEvent(e); err != nil {
+			t.Fatalf("step %v: couldn't process event: %v", i, err.Error())
+		}
+
+		if cur := m.CurStates["ITB-1101-D1"].CurNode; cur != s.node {
+			t.Errorf("step %v: expected to be in %v, was in %v", i, s.node, cur)
+		}
+		if !reflect.DeepEqual(calls, s.calls) {
+			t.Errorf("step %v: expected calls %v, got %v", i, s.calls, calls)
+		}
+	}
+}
+
+func TestStartInParent(t *testing.T) {
+	nodes := map[string]Node{
+		"off": Node{ID: "off", Transitions: []Transition{
+			{TriggerKey: "power", TriggerValue: "on", Destination: "powered"},
+		}},
+		"powered": Node{ID: "powered", Initial: "on", Transitions: []Transition{
+			{TriggerKey: "power", TriggerValue: "standby", Destination: "off"},
+		}},
+		"on": Node{ID: "on", Parent: "powered", Transitions: []Transition{
+			{TriggerKey: "blanked", TriggerValue: "true", Destination: "blank"},
+		}},
+		"blank": Node{ID: "blank", Parent: "powered", Transitions: []Transition{
+			{TriggerKey: "blanked", TriggerValue: "false", Destination: "on"},
+		}},
+	}
+
+	m, err := BuildStateMachine("deviceid", nodes, "powered", config.State{}, nopCaterpillar{})
+	if err != nil {
+		t.Fatalf("couldn't build machine: %v", err.Error())
+	}
+
+	e := events.Event{
+		Key:          "blanked",
+		Value:        "true",
+		Timestamp:    time.Now(),
+		TargetDevice: events.BasicDeviceInfo{DeviceID: "ITB-1101-D1"},
+	}
+	if err := m.ProcessEvent(e); err != nil {
+		t.Fatalf("couldn't process event: %v", err.Error())
+	}
+
+	if cur := m.CurStates["ITB-1101-D1"].CurNode; cur != "blank" {
+		t.Errorf("expected to start in on and move to blank, was in %v", cur)
+	}
+}
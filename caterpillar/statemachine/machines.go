@@ -0,0 +1,78 @@
+package statemachine
+
+import (
+	"fmt"
+
+	"github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/common/nerr"
+)
+
+//Definition describes a single machine for caterpillars that drive several machines over the same events.
+type Definition struct {
+	Name      string //must be unique within a caterpillar, used as the key for the machine's stored state.
+	ScopeKey  string
+	Nodes     map[string]Node
+	StartNode string
+}
+
+//LegacyMachine is the machine that gets state stored by a single machine caterpillar when there's more than one machine, it was the only machine before there could be several.
+const LegacyMachine = "device-state"
+
+//MachineStates is stored as the config.State Data by caterpillars running multiple machines. It's keyed by machine name, then by scope.
+type MachineStates map[string]map[string]MachineState
+
+//BuildStateMachines builds a machine for each definition, each with its own stored state pulled out of state.
+//State stored by a single machine caterpillar (a map[string]MachineState) is given to the only definition, or to LegacyMachine if there's more than one.
+//Every machine is built even if an earlier one fails validation, the first error is returned.
+func BuildStateMachines(defs []Definition, state config.State, cat catinter.Caterpillar) ([]*Machine, *nerr.E) {
+	toReturn := []*Machine{}
+	seen := map[string]bool{}
+	var toReturnErr *nerr.E
+
+	for _, d := range defs {
+		if seen[d.Name] {
+			return toReturn, nerr.Create(fmt.Sprintf("Duplicate machine name %v", d.Name), "invalid-config")
+		}
+		seen[d.Name] = true
+
+		sub := config.State{LastEventTime: state.LastEventTime}
+
+		switch v := state.Data.(type) {
+		case MachineStates:
+			if s, ok := v[d.Name]; ok {
+				sub.Data = s
+			}
+		case map[string]MachineState:
+			if len(defs) == 1 || d.Name == LegacyMachine {
+				sub.Data = v
+			}
+		}
+
+		m, err := BuildStateMachine(d.ScopeKey, d.Nodes, d.StartNode, sub, cat)
+		if m != nil {
+			m.Name = d.Name
+			toReturn = append(toReturn, m)
+		}
+		if err != nil && toReturnErr == nil {
+			toReturnErr = err.Addf("Couldn't build machine %v", d.Name)
+		}
+	}
+
+	return toReturn, toReturnErr
+}
+
+//GetMachineStates pulls the current states out of each machine so they can be stored between runs.
+func GetMachineStates(machines []*Machine) MachineStates {
+	toReturn := MachineStates{}
+
+	for _, m := range machines {
+		d := map[string]MachineState{}
+		for k, v := range m.CurStates {
+			d[k] = *v
+		}
+		toReturn[m.Name] = d
+	}
+
+	return toReturn
+}
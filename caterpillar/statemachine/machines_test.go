@@ -0,0 +1,58 @@
+package statemachine
+
+import (
+	"testing"
+
+	"github.com/byuoitav/caterpillar/config"
+)
+
+func TestBuildStateMachinesState(t *testing.T) {
+	nodes := map[string]Node{
+		"start": Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", TriggerValue: "on", Destination: "on"}}},
+		"on":    Node{ID: "on", Transitions: []Transition{{TriggerKey: "power", TriggerValue: "standby", Destination: "start"}}},
+	}
+	defs := []Definition{
+		{Name: LegacyMachine, ScopeKey: "deviceid", Nodes: nodes, StartNode: "start"},
+		{Name: "room", ScopeKey: "roomid", Nodes: nodes, StartNode: "start"},
+	}
+
+	//state from before there were multiple machines goes to the device state machine, wherever it is in the list
+	legacy := config.State{Data: map[string]MachineState{"ITB-1101-D1": {CurNode: "on"}}}
+	machines, err := BuildStateMachines([]Definition{defs[1], defs[0]}, legacy, nopCaterpillar{})
+	if err != nil {
+		t.Fatalf("couldn't build machines: %v", err.Error())
+	}
+	if len(machines[0].CurStates) != 0 || len(machines[1].CurStates) != 1 {
+		t.Fatalf("legacy state went to the wrong machine")
+	}
+
+	//or to the only machine
+	machines, err = BuildStateMachines(defs[1:], legacy, nopCaterpillar{})
+	if err != nil || len(machines[0].CurStates) != 1 {
+		t.Fatalf("legacy state wasn't given to the only machine")
+	}
+
+	machines, err = BuildStateMachines(defs, legacy, nopCaterpillar{})
+	if err != nil {
+		t.Fatalf("couldn't build machines: %v", err.Error())
+	}
+
+	machines[1].CurStates["ITB-1101"] = &MachineState{CurNode: "on"}
+
+	stored := GetMachineStates(machines)
+	machines, err = BuildStateMachines(defs, config.State{Data: stored}, nopCaterpillar{})
+	if err != nil {
+		t.Fatalf("couldn't rebuild machines: %v", err.Error())
+	}
+
+	if s, ok := machines[0].CurStates["ITB-1101-D1"]; !ok || s.CurNode != "on" {
+		t.Errorf("device machine lost its state")
+	}
+	if s, ok := machines[1].CurStates["ITB-1101"]; !ok || s.CurNode != "on" {
+		t.Errorf("room machine lost its state")
+	}
+
+	if _, err := BuildStateMachines(append(defs, defs[0]), config.State{}, nopCaterpillar{}); err == nil {
+		t.Errorf("expected an error for duplicate machine names")
+	}
+}
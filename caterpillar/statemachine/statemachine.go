@@ -2,11 +2,10 @@ package statemachine
 
 import (
 	"fmt"
-	"io/ioutil"
 	"reflect"
 	"runtime"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/awalterschulze/gographviz"
 	"github.com/byuoitav/caterpillar/caterpillar/catinter"
@@ -34,10 +33,19 @@ func BuildStateMachine(scopeKey string, nodes map[string]Node, startNode string,
 		Caterpillar: cat,
 	}
 
+	//the machine is still returned on a validation error so the caller can inspect what was built.
+	if err := ValidationError(Validate(nodes, startNode)); err != nil {
+		return &m, err.Addf("Couldn't build state machine.")
+	}
+
 	if state.Data != nil {
 		if v, ok := state.Data.(map[string]MachineState); ok {
 			for k := range v {
 				val := v[k]
+				//states stored before we tracked event times are treated as last seen at the end of the last run.
+				if val.LastEvent.IsZero() {
+					val.LastEvent = state.LastEventTime
+				}
 				m.CurStates[k] = &val
 			}
 		}
@@ -46,8 +54,15 @@ func BuildStateMachine(scopeKey string, nodes map[string]Node, startNode string,
 	return &m, nil
 }
 
+//Definer is implemented by caterpillars that are built on state machines. It lets the machines be built (to validate or draw them) without running the caterpillar.
+//State is the state stored from the caterpillar's last run, and may be empty.
+type Definer interface {
+	GetMachines(c config.Caterpillar, state config.State) ([]*Machine, *nerr.E)
+}
+
 //Machine .
 type Machine struct {
+	Name      string
 	ScopeKey  string
 	Nodes     map[string]Node
 	OutChan   chan nydus.BulkRecordHeader
@@ -56,12 +71,17 @@ type Machine struct {
 	CurStates map[string]*MachineState
 
 	Caterpillar catinter.Caterpillar
+
+	OnTransition func(machine, from, to string) //called after each transition that changes the current node, if set.
 }
 
 //MachineState .
 type MachineState struct {
 	CurNode    string
 	ValueStore map[string]interface{}
+
+	LastEvent  time.Time              //timestamp of the last event processed for this scope, used for expiring stale states.
+	LastTarget events.BasicDeviceInfo //target device of the last event processed for this scope.
 }
 
 //Node .
@@ -70,6 +90,10 @@ type Node struct {
 	Enter       func(map[string]interface{}, events.Event) ([]cst.MetricsRecord, *nerr.E)
 	Exit        func(map[string]interface{}, events.Event) ([]cst.MetricsRecord, *nerr.E)
 	Transitions []Transition //if match multiple transitions, the first declared will be taken.
+	Terminal    bool         //if true the node is allowed to have no transitions out of it.
+
+	Parent  string //if set, this node is nested inside of Parent. It inherits Parent's transitions (after its own), and Parent's enter/exit run when the machine moves into or out of Parent as a whole.
+	Initial string //for a parent node, the child the machine moves into when this node is the destination of a transition.
 }
 
 //Transition .
@@ -78,6 +102,7 @@ type Transition struct {
 	TriggerKey   string      //check for the event.key
 	TriggerValue interface{} //Corresponds to event.Value. Either a concrete value (string), or if you want to tigger on a == or != relationship with a store value, you can use a TransitionTrigger value.
 
+	Guard    func(map[string]interface{}, events.Event) bool                             //if set, the transition is only taken when it returns true. Runs before any exits, so it sees the store as it was before the event.
 	Actions  []func(map[string]interface{}, events.Event) ([]cst.MetricsRecord, *nerr.E) //runs before ANY transitionbbbb
 	Internal bool                                                                        //if true and destination and source nodes are the same, it won't run th enter and exit jobs
 
@@ -89,55 +114,6 @@ type TransitionStoreValue struct {
 	StoreValue string
 }
 
-//PrintSimpleDotFile .
-func (m *Machine) PrintSimpleDotFile() *nerr.E {
-	graph := gographviz.NewGraph()
-	graph.SetDir(true)
-
-	for i := range m.Nodes {
-		err := graph.AddNode("Machines", m.Nodes[i].ID, map[string]string{
-			"shape":     "octagon",
-			"color":     "\"#e53935\"",
-			"fontcolor": "\"#e53935\"",
-		})
-		if err != nil {
-			log.L.Errorf("%v", err.Error())
-			return nerr.Translate(err)
-		}
-
-		for j, t := range m.Nodes[i].Transitions {
-			pid := strconv.Itoa(j) //pathid, grows as it moves
-			//add a node for this exit (if any)
-			name, err := AddExit(m.Nodes[i], pid, t, graph)
-			if err != nil {
-				return err
-			}
-			//now we add one for each action
-			for k, a := range t.Actions {
-
-				pid += strconv.Itoa(k)
-				name, err = AddAction(m.Nodes[i], name, pid, t, a, graph, name == m.Nodes[i].ID)
-				if err != nil {
-					return err
-				}
-			}
-			//now we check to see if there's an entry node for our destination
-			name, err = AddEntry(m.Nodes[i], m.Nodes[t.Destination], name, pid, t, graph, name == m.Nodes[i].ID)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	fmt.Printf("%v\n", graph.String())
-	err := ioutil.WriteFile("simple-out.dot", []byte(graph.String()), 0777)
-	if err != nil {
-		log.L.Errorf("Coudn't write dot file: %v.", err)
-		return nerr.Translate(err)
-	}
-
-	return nil
-}
-
 //AddAction .
 func AddAction(n Node, prev, transitionID string, t Transition, a func(map[string]interface{}, events.Event) ([]catinter.MetricsRecord, *nerr.E), g *gographviz.Graph, transitionLabel bool) (string, *nerr.E) {
 	name := runtime.FuncForPC(reflect.ValueOf(a).Pointer()).Name()
@@ -0,0 +1,176 @@
+package statemachine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/byuoitav/common/nerr"
+)
+
+//Problem is a single issue found while validating a state machine definition.
+type Problem struct {
+	Machine    string `json:"machine,omitempty"`
+	Node       string `json:"node,omitempty"`
+	Transition int    `json:"transition"` //index of the transition within the node, -1 if the problem is with the node itself.
+	Message    string `json:"message"`
+}
+
+func (p Problem) String() string {
+	prefix := ""
+	if len(p.Machine) > 0 {
+		prefix = fmt.Sprintf("machine %v ", p.Machine)
+	}
+
+	if len(p.Node) == 0 {
+		return prefix + p.Message
+	}
+	if p.Transition < 0 {
+		return fmt.Sprintf("%vnode %v: %v", prefix, p.Node, p.Message)
+	}
+	return fmt.Sprintf("%vnode %v transition %v: %v", prefix, p.Node, p.Transition, p.Message)
+}
+
+//Validate checks the static structure of a state machine definition. It makes sure that the start node exists, every destination and parent is defined,
+//every node can be reached from the start node, no node is a dead end unless marked terminal, and no transition is completely shadowed by an earlier one.
+//A child overriding one of its parent's transitions is not considered shadowing.
+//Problems are returned sorted by node so that output is stable between calls.
+func Validate(nodes map[string]Node, startNode string) []Problem {
+	toReturn := []Problem{}
+
+	if _, ok := nodes[startNode]; !ok {
+		toReturn = append(toReturn, Problem{Transition: -1, Message: fmt.Sprintf("start node %v is not defined", startNode)})
+	}
+
+	ids := []string{}
+	for k := range nodes {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+
+	for _, k := range ids {
+		n := nodes[k]
+
+		if n.ID != k {
+			toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: fmt.Sprintf("node is stored under %v but has ID %v", k, n.ID)})
+		}
+
+		if len(n.Parent) > 0 {
+			if _, ok := nodes[n.Parent]; !ok {
+				toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: fmt.Sprintf("parent %v is not defined", n.Parent)})
+			} else if isAncestor(nodes, k, n.Parent) {
+				toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: fmt.Sprintf("parent %v is nested inside of this node", n.Parent)})
+			}
+		}
+
+		if len(n.Initial) > 0 {
+			if c, ok := nodes[n.Initial]; !ok || c.Parent != k {
+				toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: fmt.Sprintf("initial node %v is not a child of this node", n.Initial)})
+			}
+		}
+
+		for i, t := range n.Transitions {
+			if _, ok := nodes[t.Destination]; !ok {
+				toReturn = append(toReturn, Problem{Node: k, Transition: i, Message: fmt.Sprintf("destination %v is not defined", t.Destination)})
+			}
+
+			switch t.TriggerValue.(type) {
+			case nil, string, TransitionStoreValue:
+			default:
+				toReturn = append(toReturn, Problem{Node: k, Transition: i, Message: fmt.Sprintf("unkown trigger value type %T", t.TriggerValue)})
+			}
+
+			for j := 0; j < i; j++ {
+				if shadows(n.Transitions[j], t) {
+					toReturn = append(toReturn, Problem{Node: k, Transition: i, Message: fmt.Sprintf("transition is shadowed by transition %v", j)})
+					break
+				}
+			}
+		}
+
+		//transitions inherited from parents count towards getting out of a node
+		leaves := false
+		for _, t := range effectiveTransitions(nodes, k) {
+			if _, ok := nodes[t.Destination]; !ok || (t.Internal && isAncestor(nodes, t.Destination, k)) {
+				continue
+			}
+			if resolveInitial(nodes, t.Destination) != k {
+				leaves = true
+				break
+			}
+		}
+
+		if !leaves && !n.Terminal {
+			toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: "node is a dead end and isn't marked terminal"})
+		}
+	}
+
+	//walk the graph from the start node to find anything we can't get to. Sitting in a node means sitting in each of its parents as well.
+	if _, ok := nodes[startNode]; ok {
+		reached := map[string]bool{}
+		queue := []string{resolveInitial(nodes, startNode)}
+
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			if reached[cur] {
+				continue
+			}
+
+			for _, a := range ancestors(nodes, cur) {
+				reached[a] = true
+			}
+
+			for _, t := range effectiveTransitions(nodes, cur) {
+				if _, ok := nodes[t.Destination]; !ok {
+					continue
+				}
+				if dst := resolveInitial(nodes, t.Destination); !reached[dst] {
+					queue = append(queue, dst)
+				}
+			}
+		}
+
+		for _, k := range ids {
+			if !reached[k] {
+				toReturn = append(toReturn, Problem{Node: k, Transition: -1, Message: fmt.Sprintf("node is unreachable from start node %v", startNode)})
+			}
+		}
+	}
+
+	return toReturn
+}
+
+//ValidationError wraps the problems from Validate into a single error, returns nil if there are no problems.
+func ValidationError(problems []Problem) *nerr.E {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	msgs := []string{}
+	for i := range problems {
+		msgs = append(msgs, problems[i].String())
+	}
+
+	return nerr.Create(fmt.Sprintf("Invalid state machine definition: %v", strings.Join(msgs, "; ")), "invalid-machine")
+}
+
+//shadows returns true if every event that would trigger later would already be caught by earlier.
+func shadows(earlier, later Transition) bool {
+	if earlier.TriggerKey != later.TriggerKey || earlier.Guard != nil {
+		return false
+	}
+
+	switch v := earlier.TriggerValue.(type) {
+	case nil:
+		return true
+	case string:
+		lv, ok := later.TriggerValue.(string)
+		return ok && lv == v
+	case TransitionStoreValue:
+		lv, ok := later.TriggerValue.(TransitionStoreValue)
+		return ok && lv.StoreValue == v.StoreValue
+	}
+
+	return false
+}
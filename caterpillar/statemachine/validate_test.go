@@ -0,0 +1,89 @@
+package statemachine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    map[string]Node
+		start    string
+		problems []string
+	}{
+		{
+			name: "valid",
+			nodes: map[string]Node{
+				"start": Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", TriggerValue: "on", Destination: "on"}}},
+				"on":    Node{ID: "on", Transitions: []Transition{{TriggerKey: "power", TriggerValue: "standby", Destination: "start"}}},
+			},
+			start: "start",
+		},
+		{
+			name: "missing start",
+			nodes: map[string]Node{
+				"on": Node{ID: "on", Terminal: true},
+			},
+			start:    "start",
+			problems: []string{"start node start is not defined"},
+		},
+		{
+			name: "missing destination",
+			nodes: map[string]Node{
+				"start": Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", Destination: "nowhere"}}},
+			},
+			start:    "start",
+			problems: []string{"node start transition 0: destination nowhere is not defined", "node start: node is a dead end"},
+		},
+		{
+			name: "unreachable",
+			nodes: map[string]Node{
+				"start":  Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", Destination: "on"}}},
+				"on":     Node{ID: "on", Terminal: true},
+				"orphan": Node{ID: "orphan", Transitions: []Transition{{TriggerKey: "power", Destination: "on"}}},
+			},
+			start:    "start",
+			problems: []string{"node orphan: node is unreachable"},
+		},
+		{
+			name: "dead end",
+			nodes: map[string]Node{
+				"start": Node{ID: "start", Transitions: []Transition{{TriggerKey: "power", Destination: "on"}}},
+				"on":    Node{ID: "on", Transitions: []Transition{{TriggerKey: "input", Destination: "on", Internal: true}}},
+			},
+			start:    "start",
+			problems: []string{"node on: node is a dead end"},
+		},
+		{
+			name: "shadowed",
+			nodes: map[string]Node{
+				"start": Node{ID: "start", Transitions: []Transition{
+					{TriggerKey: "power", Destination: "on"},
+					{TriggerKey: "power", TriggerValue: "on", Destination: "on"},
+					{TriggerKey: "input", TriggerValue: "hdmi1", Destination: "on"},
+					{TriggerKey: "input", TriggerValue: "hdmi2", Destination: "on"},
+					{TriggerKey: "input", TriggerValue: "hdmi1", Destination: "start"},
+				}},
+				"on": Node{ID: "on", Terminal: true},
+			},
+			start:    "start",
+			problems: []string{"node start transition 1: transition is shadowed by transition 0", "node start transition 4: transition is shadowed by transition 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := Validate(tt.nodes, tt.start)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("expected %v problems, got %v: %v", len(tt.problems), len(problems), problems)
+			}
+
+			for i := range problems {
+				if !strings.HasPrefix(problems[i].String(), tt.problems[i]) {
+					t.Errorf("expected problem %q, got %q", tt.problems[i], problems[i].String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+//Package timebucket splits time into the fixed buckets the counting caterpillars (power count, error rate, aggregate) report on.
+//
+//Buckets are on Denver's wall clock and aligned to midnight, so a day bucket is 23 or 25 hours long across a daylight saving time change.
+//Buckets of an hour or less are cut from absolute time instead, so the repeated hour when the clocks fall back is two buckets rather than one.
+//
+//The caterpillars keep each scope's unfinished bucket in their stored state between runs, and finish it once an event past its end shows up,
+//or a later run sees one (see Ended).
+package timebucket
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
+)
+
+//Interval is the length of a bucket.
+type Interval time.Duration
+
+//Common intervals
+const (
+	Hour = Interval(time.Hour)
+	Day  = Interval(24 * time.Hour)
+)
+
+var location *time.Location
+
+func init() {
+	var er error
+	location, er = time.LoadLocation("America/Denver")
+	if er != nil {
+		log.L.Fatalf("Couldn't load timezone: %v", er.Error())
+	}
+}
+
+//Parse parses a bucket interval, e.g. 15m or 2h. It has to evenly divide an hour, or be a whole number of hours that evenly divides a day.
+func Parse(v string) (Interval, *nerr.E) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || (24*time.Hour)%d != 0 || (time.Hour%d != 0 && d%time.Hour != 0) {
+		return 0, nerr.Create(fmt.Sprintf("Invalid bucket-interval %v, must evenly divide an hour, or be a whole number of hours that evenly divides a day", v), "invalid-config")
+	}
+
+	return Interval(d), nil
+}
+
+//Start finds the start of the bucket t is in.
+func (i Interval) Start(t time.Time) time.Time {
+	d := time.Duration(i)
+	if time.Hour%d == 0 {
+		//Denver is always a whole number of hours off UTC, so this lines up with the wall clock.
+		return t.Truncate(d).In(location)
+	}
+
+	t = t.In(location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return wallTime(t, sinceMidnight/d*d)
+}
+
+//End finds the end of the bucket that starts at start.
+func (i Interval) End(start time.Time) time.Time {
+	d := time.Duration(i)
+	if time.Hour%d == 0 {
+		return start.Add(d)
+	}
+
+	start = start.In(location)
+	sinceMidnight := time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	return wallTime(start, (sinceMidnight/d+1)*d)
+}
+
+//Ended is true if the bucket that starts at start ended by last, the time of the latest event seen. Events are fed in order, so it won't get any more.
+func (i Interval) Ended(start, last time.Time) bool {
+	return !i.End(start).After(last)
+}
+
+//wallTime is d past midnight on the wall clock, on day's date. 24h is the next midnight.
+//A time in the hour skipped when the clocks spring forward is moved past it, time.Date would move it back an hour instead.
+func wallTime(day time.Time, d time.Duration) time.Time {
+	y, m, dd := day.Date()
+	t := time.Date(y, m, dd, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, location)
+	if t.Hour() != int(d/time.Hour)%24 {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
@@ -0,0 +1,46 @@
+package timebucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDST(t *testing.T) {
+	mdt := time.FixedZone("MDT", -6*60*60)
+	mst := time.FixedZone("MST", -7*60*60)
+
+	tests := []struct {
+		name       string
+		interval   Interval
+		at         time.Time
+		start, end time.Time
+	}{
+		{"fall back day", Day, time.Date(2019, 11, 3, 23, 30, 0, 0, mst), time.Date(2019, 11, 3, 0, 0, 0, 0, mdt), time.Date(2019, 11, 4, 0, 0, 0, 0, mst)},
+		{"spring forward day", Day, time.Date(2019, 3, 10, 12, 0, 0, 0, mdt), time.Date(2019, 3, 10, 0, 0, 0, 0, mst), time.Date(2019, 3, 11, 0, 0, 0, 0, mdt)},
+		{"first 1:00 hour", Hour, time.Date(2019, 11, 3, 1, 30, 0, 0, mdt), time.Date(2019, 11, 3, 1, 0, 0, 0, mdt), time.Date(2019, 11, 3, 1, 0, 0, 0, mst)},
+		{"second 1:00 hour", Hour, time.Date(2019, 11, 3, 1, 30, 0, 0, mst), time.Date(2019, 11, 3, 1, 0, 0, 0, mst), time.Date(2019, 11, 3, 2, 0, 0, 0, mst)},
+		{"15m in the second 1:00 hour", Interval(15 * time.Minute), time.Date(2019, 11, 3, 1, 20, 0, 0, mst), time.Date(2019, 11, 3, 1, 15, 0, 0, mst), time.Date(2019, 11, 3, 1, 30, 0, 0, mst)},
+		{"2h over fall back", Interval(2 * time.Hour), time.Date(2019, 11, 3, 1, 30, 0, 0, mst), time.Date(2019, 11, 3, 0, 0, 0, 0, mdt), time.Date(2019, 11, 3, 2, 0, 0, 0, mst)},
+		{"2h after fall back", Interval(2 * time.Hour), time.Date(2019, 11, 3, 15, 0, 0, 0, mst), time.Date(2019, 11, 3, 14, 0, 0, 0, mst), time.Date(2019, 11, 3, 16, 0, 0, 0, mst)},
+		{"2h over spring forward", Interval(2 * time.Hour), time.Date(2019, 3, 10, 1, 30, 0, 0, mst), time.Date(2019, 3, 10, 0, 0, 0, 0, mst), time.Date(2019, 3, 10, 3, 0, 0, 0, mdt)},
+		{"2h after spring forward", Interval(2 * time.Hour), time.Date(2019, 3, 10, 3, 30, 0, 0, mdt), time.Date(2019, 3, 10, 3, 0, 0, 0, mdt), time.Date(2019, 3, 10, 4, 0, 0, 0, mdt)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.interval.Start(tt.at)
+			if !start.Equal(tt.start) {
+				t.Fatalf("expected the bucket to start at %v, got %v", tt.start, start)
+			}
+			if end := tt.interval.End(start); !end.Equal(tt.end) {
+				t.Errorf("expected the bucket to end at %v, got %v", tt.end, end)
+			}
+		})
+	}
+
+	for _, v := range []string{"7h", "45m", "90m", "0s", "48h", "hour"} {
+		if _, err := Parse(v); err == nil {
+			t.Errorf("expected an error for %v", v)
+		}
+	}
+}
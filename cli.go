@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/byuoitav/caterpillar/caterpillar"
+	"github.com/byuoitav/caterpillar/caterpillar/displayinput"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/hatchery"
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+)
+
+//commands are run instead of the server when the first argument matches one of them, e.g. `caterpillar validate -id core-state`.
+var commands = map[string]func(args []string) int{
+	"validate": validateCommand,
+	"diagram":  diagramCommand,
+	"migrate":  migrateCommand,
+}
+
+//runCommand returns false if there wasn't a command to run and the server should be started, otherwise it returns the exit code of the command.
+func runCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	return cmd(args[1:]), true
+}
+
+//setConfigLocation lets commands point at a config file other than the one the server would use.
+func setConfigLocation(file string) {
+	if len(file) > 0 {
+		os.Setenv("CONFIG_LOCATION", file)
+	}
+}
+
+func validateCommand(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	file := fs.String("config", "", "config file to validate, defaults to CONFIG_LOCATION or ./service-config.json")
+	id := fs.String("id", "", "only validate the caterpillar with this id")
+	fs.Parse(args)
+
+	setConfigLocation(*file)
+	c, err := config.GetConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+		return 2
+	}
+
+	failed := false
+	for _, cat := range c.Caterpillars {
+		if len(*id) > 0 && cat.ID != *id {
+			continue
+		}
+
+		problems, err := caterpillar.ValidateCaterpillar(cat)
+		if err != nil {
+			fmt.Printf("%v: %v\n", cat.ID, err.Error())
+			failed = true
+			continue
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("%v: ok\n", cat.ID)
+			continue
+		}
+
+		failed = true
+		fmt.Printf("%v: %v problems\n", cat.ID, len(problems))
+		for i := range problems {
+			fmt.Printf("\t%v\n", problems[i].String())
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func diagramCommand(args []string) int {
+	fs := flag.NewFlagSet("diagram", flag.ExitOnError)
+	file := fs.String("config", "", "config file to read, defaults to CONFIG_LOCATION or ./service-config.json")
+	id := fs.String("id", "", "id of the caterpillar to draw (required)")
+	machine := fs.String("machine", "", "machine to draw for caterpillars running more than one, defaults to the first")
+	format := fs.String("format", sm.Dot, "one of dot, svg, or mmd")
+	counts := fs.Bool("counts", false, "label nodes with counts from the stored state. Reads the store, so can't be used while the server is running")
+	out := fs.String("o", "", "file to write to, defaults to stdout")
+	fs.Parse(args)
+
+	if len(*id) == 0 {
+		fmt.Fprintf(os.Stderr, "-id is required\n")
+		fs.Usage()
+		return 2
+	}
+
+	setConfigLocation(*file)
+	c, err := config.GetConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+		return 2
+	}
+
+	for _, cat := range c.Caterpillars {
+		if cat.ID != *id {
+			continue
+		}
+
+		b, err := hatchery.RenderMachine(cat, *machine, *format, *counts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+			return 1
+		}
+
+		if len(*out) == 0 {
+			os.Stdout.Write(b)
+			return 0
+		}
+
+		if er := ioutil.WriteFile(*out, b, 0644); er != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't write %v: %v\n", *out, er.Error())
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "No caterpillar with id %v\n", *id)
+	return 1
+}
+
+func migrateCommand(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	file := fs.String("config", "", "config file to read, defaults to CONFIG_LOCATION or ./service-config.json")
+	id := fs.String("id", "", "id of the caterpillar whose sql settings to use, defaults to METRICS_SQL_DRIVER and METRICS_SQL_CONNECTION_STRING")
+	status := fs.Bool("status", false, "only print the current schema version")
+	fs.Parse(args)
+
+	sqlConfig := metricssql.Config{}
+	if len(*id) > 0 {
+		setConfigLocation(*file)
+		c, err := config.GetConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+			return 2
+		}
+
+		found := false
+		for _, cat := range c.Caterpillars {
+			if cat.ID == *id {
+				sqlConfig = displayinput.GetConfig(cat.TypeConfig).SQL
+				found = true
+			}
+		}
+
+		if !found {
+			fmt.Fprintf(os.Stderr, "No caterpillar with id %v\n", *id)
+			return 1
+		}
+	}
+
+	db, er := metricssql.Open(sqlConfig)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", er.Error())
+		return 1
+	}
+	defer db.Close()
+
+	if !*status {
+		applied, er := db.Migrate()
+		for _, m := range applied {
+			fmt.Printf("applied %v: %v\n", m.Version, m.Description)
+		}
+		if er != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", er.Error())
+			return 1
+		}
+	}
+
+	version, er := db.SchemaVersion()
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", er.Error())
+		return 1
+	}
+
+	fmt.Printf("schema version: %v\n", version)
+	return 0
+}
@@ -0,0 +1,70 @@
+package hatchery
+
+import (
+	"fmt"
+
+	"github.com/byuoitav/caterpillar/caterpillar"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
+	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/hatchery/store"
+	"github.com/byuoitav/common/nerr"
+)
+
+//GetMachineDiagram renders a state machine of the caterpillar with the given id, see RenderMachine.
+func (h *Hatchery) GetMachineDiagram(id, machine, format string, counts bool) ([]byte, *nerr.E) {
+	for i := range h.Queens {
+		if h.Queens[i].config.ID == id {
+			return RenderMachine(h.Queens[i].config, machine, format, counts)
+		}
+	}
+
+	return []byte{}, nerr.Create(fmt.Sprintf("No caterpillar with id %v", id), "not-found")
+}
+
+//RenderMachine renders one of the state machines of a caterpillar in the given format (dot, svg, or mmd). If machine is empty the first machine is drawn.
+//If counts is true, nodes are labeled with how many devices (or rooms, etc.) were sitting in them as of the caterpillar's last stored state.
+func RenderMachine(c config.Caterpillar, machine, format string, counts bool) ([]byte, *nerr.E) {
+	state := config.State{}
+
+	if counts {
+		cat, err := caterpillar.GetCaterpillar(c.Type)
+		if err != nil {
+			return []byte{}, err.Addf("Couldn't render machine for %v", c.ID)
+		}
+		cat.RegisterGobStructs()
+
+		state, err = store.GetInfo(c.ID)
+		if err != nil {
+			return []byte{}, err.Addf("Couldn't render machine for %v", c.ID)
+		}
+	}
+
+	//an invalid machine can still be drawn, that's often the easiest way to see what's wrong with it.
+	machines, err := caterpillar.GetMachines(c, state)
+	if err != nil && len(machines) == 0 {
+		return []byte{}, err.Addf("Couldn't render machine for %v", c.ID)
+	}
+
+	for _, m := range machines {
+		if len(machine) > 0 && m.Name != machine {
+			continue
+		}
+
+		var nodeCounts map[string]int
+		if counts {
+			nodeCounts = m.NodeCounts()
+		}
+
+		return m.Render(format, nodeCounts)
+	}
+
+	return []byte{}, nerr.Create(fmt.Sprintf("Caterpillar %v has no machine %v", c.ID, machine), "not-found")
+}
+
+//ContentType returns the content type a diagram format should be served with.
+func ContentType(format string) string {
+	if v, ok := sm.ContentTypes[format]; ok {
+		return v
+	}
+	return "application/octet-stream"
+}
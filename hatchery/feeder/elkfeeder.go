@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/byuoitav/caterpillar/config"
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/caterpillar/v2/elkquery"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
@@ -35,6 +36,11 @@ type elkFeeder struct {
 	countOnce  *sync.Once
 }
 
+//Window .
+func (e *elkFeeder) Window() (time.Time, time.Time) {
+	return e.startTime, e.endTime
+}
+
 //GetCount .
 func (e *elkFeeder) GetCount() (int, *nerr.E) {
 
@@ -82,7 +88,7 @@ func (e *elkFeeder) getElkCount() (int, *nerr.E) {
 		return 0, nerr.Translate(er).Addf("Couldn't get count for caterpillar %v", e.config.ID)
 	}
 
-	respBytes, err := elk.MakeELKRequest("POST", fmt.Sprintf("/%v/_count", e.config.Index), queryBytes)
+	respBytes, err := e.makeELKRequest("count", fmt.Sprintf("/%v/_count", e.config.Index), queryBytes)
 	if err != nil {
 		return 0, err.Addf("Couldn't get count of documents for caterpillar %v", e.config.ID)
 	}
@@ -134,6 +140,7 @@ func (e *elkFeeder) run(events []interface{}) {
 			e.eventChannel <- events[i]
 			e.eventssent++
 		}
+		metrics.EventsFed.WithLabelValues(e.config.ID).Add(float64(len(events)))
 		if e.eventssent >= e.eventcount {
 			log.L.Infof("Feeding of caterpillar %v done. Closing the feeder.", e.config.ID)
 			return
@@ -157,7 +164,7 @@ func (e *elkFeeder) executeQuery(q elkquery.QueryTemplate) (queries.QueryRespons
 		return queries.QueryResponse{}, nerr.Translate(er).Addf("Couldn't execute query.")
 	}
 
-	resp, err := elk.MakeELKRequest("POST", fmt.Sprintf("/%v/_search", e.config.Index), b)
+	resp, err := e.makeELKRequest("search", fmt.Sprintf("/%v/_search", e.config.Index), b)
 	if err != nil {
 		return queries.QueryResponse{}, err.Addf("COuldn't get count of documents for caterpillar %v", e.config.ID)
 	}
@@ -171,6 +178,19 @@ func (e *elkFeeder) executeQuery(q elkquery.QueryTemplate) (queries.QueryRespons
 	return toReturn, nil
 }
 
+//makeELKRequest POSTs to ELK, keeping track of how long the request took and if it failed. operation is count or search.
+func (e *elkFeeder) makeELKRequest(operation, endpoint string, body []byte) ([]byte, *nerr.E) {
+	start := time.Now()
+	resp, err := elk.MakeELKRequest("POST", endpoint, body)
+	metrics.FeederRequestDuration.WithLabelValues(e.config.ID, operation).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.FeederRequestErrors.WithLabelValues(e.config.ID, operation).Inc()
+	}
+
+	return resp, err
+}
+
 func (e *elkFeeder) getNextBatch() ([]interface{}, *nerr.E) {
 
 	query, err := e.getNextQuery()
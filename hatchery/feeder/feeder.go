@@ -18,6 +18,7 @@ const (
 type Feeder interface {
 	GetCount() (int, *nerr.E)
 	StartFeeding(capacity int) (chan interface{}, *nerr.E)
+	Window() (time.Time, time.Time) //the start and end of the events being fed.
 }
 
 var absDateFormat = "2006-01-02 15:04:05"
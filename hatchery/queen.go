@@ -2,14 +2,19 @@ package hatchery
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/byuoitav/caterpillar/caterpillar"
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
 	"github.com/byuoitav/caterpillar/config"
 	"github.com/byuoitav/caterpillar/hatchery/feeder"
 	"github.com/byuoitav/caterpillar/hatchery/store"
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/caterpillar/nydus"
 	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/nerr"
 )
 
 const (
@@ -17,6 +22,7 @@ const (
 	initialwaiting = "initial-waiting"
 	donewaiting    = "done-waiting"
 	errorwaiting   = "error-waiting"
+	invalidconfig  = "invalid-config"
 )
 
 //Queen .
@@ -25,10 +31,12 @@ type Queen struct {
 	config       config.Caterpillar
 	runMutex     *sync.Mutex
 	nydusChannel chan nydus.BulkRecordEntry
+	invalid      string //why the config failed validation, only set by SpawnQueen so it's safe to read without the run lock.
 
 	State     string
 	LastError string
 	LastRun   time.Time
+	LastRunID int
 }
 
 //QueenStatus .
@@ -37,16 +45,30 @@ type QueenStatus struct {
 	LastRun       time.Time          `json:"last-run"`
 	Configuration config.Caterpillar `json:"caterpillar-config"`
 	LastError     string             `json:"last-error,omitempty"`
+	LastRunID     int                `json:"last-run-id,omitempty"`
 }
 
-//SpawnQueen .
+//SpawnQueen validates the caterpillar config. If it isn't valid the queen is still returned, but will refuse to run.
 func SpawnQueen(c config.Caterpillar, nn chan nydus.BulkRecordEntry) *Queen {
-	return &Queen{
+	q := &Queen{
 		config:       c,
 		runMutex:     &sync.Mutex{},
 		nydusChannel: nn,
 		State:        initialwaiting,
 	}
+
+	problems, err := caterpillar.ValidateCaterpillar(c)
+	if err == nil {
+		err = sm.ValidationError(problems)
+	}
+	if err != nil {
+		log.L.Errorf("Caterpillar %v failed validation, it will not be run: %v", c.ID, err.Error())
+		q.State = invalidconfig
+		q.LastError = err.Error()
+		q.invalid = err.Error()
+	}
+
+	return q
 }
 
 //GetStatus .
@@ -56,21 +78,57 @@ func (q Queen) GetStatus() QueenStatus {
 		LastRun:       q.LastRun,
 		Configuration: q.config,
 		LastError:     q.LastError,
+		LastRunID:     q.LastRunID,
 	}
 }
 
 //Run fulfills the job interface for the cron package.
+//Each run is recorded in the caterpillar's run history in the store, see store.Run.
 func (q *Queen) Run() {
 
 	log.L.Debugf("Obtaining a run lock for %v", q.config.ID)
 
+	if len(q.invalid) > 0 {
+		log.L.Warnf("Not running %v, it failed validation: %v", q.config.ID, q.invalid)
+		metrics.QueenRuns.WithLabelValues(q.config.ID, q.config.Type, metrics.Skipped).Inc()
+		return
+	}
+
 	//wait for the lock
 	q.runMutex.Lock()
 	q.State = running
 
+	start := time.Now()
+	metrics.QueenRunning.WithLabelValues(q.config.ID, q.config.Type).Set(1)
+
+	run := store.Run{
+		Caterpillar: q.config.ID,
+		Start:       start,
+		Records:     map[string]int{},
+	}
+
 	defer func() {
-		q.runMutex.Unlock()
 		q.LastRun = time.Now()
+
+		run.End = q.LastRun
+		run.State = q.State
+		run.Error = q.LastError
+		stored, err := store.PutRun(q.config.ID, run)
+		if err != nil {
+			log.L.Errorf(err.Addf("Couldn't store run history for caterpillar %v.", q.config.ID).Error())
+		} else {
+			q.LastRunID = stored.ID
+		}
+		q.runMutex.Unlock()
+
+		metrics.QueenRunning.WithLabelValues(q.config.ID, q.config.Type).Set(0)
+		metrics.QueenRunDuration.WithLabelValues(q.config.ID, q.config.Type).Observe(q.LastRun.Sub(start).Seconds())
+		if q.State == donewaiting {
+			metrics.QueenRuns.WithLabelValues(q.config.ID, q.config.Type, metrics.Success).Inc()
+			metrics.QueenLastSuccess.WithLabelValues(q.config.ID, q.config.Type).Set(float64(q.LastRun.Unix()))
+		} else {
+			metrics.QueenRuns.WithLabelValues(q.config.ID, q.config.Type, metrics.Failure).Inc()
+		}
 	}()
 
 	log.L.Infof("Starting run of %v.", q.config.ID)
@@ -109,6 +167,11 @@ func (q *Queen) Run() {
 		return
 	}
 
+	run.WindowStart, run.WindowEnd = feed.Window()
+	if w, ok := cat.(ci.Windowed); ok {
+		w.SetWindow(run.WindowStart, run.WindowEnd)
+	}
+
 	count, err := feed.GetCount()
 	if err != nil {
 		log.L.Errorf(err.Addf("Couldn't get event count from feeder for %v from info store. Returning.", q.config.ID).Error())
@@ -118,8 +181,20 @@ func (q *Queen) Run() {
 		return
 	}
 
+	run.EventsCounted = count
+
 	//Run the caterpillar - this should block until the cateprillar is done chewing through the data.
-	state, err := cat.Run(q.config.ID, count, info, q.nydusChannel, q.config, feed.StartFeeding)
+	var processed int64
+	out, done := q.countRecords(run.Records)
+	state, err := cat.Run(q.config.ID, count, info, out, q.config, countEvents(feed.StartFeeding, &processed))
+	close(out)
+	<-done
+
+	run.EventsProcessed = int(atomic.LoadInt64(&processed))
+	if r, ok := cat.(ci.EventErrorReporter); ok {
+		run.AddErrors(r.EventErrors())
+	}
+
 	if err != nil {
 		log.L.Error(err.Addf("There was an error running caterpillar %v: %v", q.config.ID, err.Error()))
 		log.L.Debugf("%s", err.Stack)
@@ -143,3 +218,61 @@ func (q *Queen) Run() {
 	q.State = donewaiting
 
 }
+
+//countRecords gives the caterpillar a channel of its own for a run, counting the records sent on it by type (into records) before passing them on to the nydus network.
+//Close the channel once the run is done, then wait on done for the rest of the records to be passed on. records mustn't be read until then.
+func (q *Queen) countRecords(records map[string]int) (chan nydus.BulkRecordEntry, chan struct{}) {
+	out := make(chan nydus.BulkRecordEntry, 100)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for r := range out {
+			t := recordType(r)
+			records[t]++
+			metrics.RecordsEmitted.WithLabelValues(q.config.ID, t).Inc()
+			q.nydusChannel <- r
+		}
+	}()
+
+	return out, done
+}
+
+//countEvents wraps the feeder's StartFeeding, counting each event the caterpillar takes off the channel in processed.
+func countEvents(startFeeding func(int) (chan interface{}, *nerr.E), processed *int64) func(int) (chan interface{}, *nerr.E) {
+	return func(capacity int) (chan interface{}, *nerr.E) {
+		in, err := startFeeding(capacity)
+		if err != nil {
+			return in, err
+		}
+
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+
+			for e := range in {
+				out <- e
+				atomic.AddInt64(processed, 1)
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+//recordType gets the record type of a record, falling back to the type in its header.
+func recordType(r nydus.BulkRecordEntry) string {
+	switch body := r.Body.(type) {
+	case ci.MetricsRecord:
+		if len(body.RecordType) > 0 {
+			return body.RecordType
+		}
+	case map[string]interface{}:
+		if t, ok := body["record-type"].(string); ok && len(t) > 0 {
+			return t
+		}
+	}
+
+	return r.Header.Index.Type
+}
@@ -0,0 +1,41 @@
+package hatchery
+
+import (
+	"fmt"
+
+	"github.com/byuoitav/caterpillar/hatchery/store"
+	"github.com/byuoitav/common/nerr"
+)
+
+//GetRuns returns the run history of the caterpillar with the given id, newest first.
+func (h *Hatchery) GetRuns(id string) ([]store.Run, *nerr.E) {
+	if !h.hasQueen(id) {
+		return []store.Run{}, nerr.Create(fmt.Sprintf("No caterpillar with id %v", id), "not-found")
+	}
+
+	runs, err := store.GetRuns(id)
+	if err != nil {
+		return runs, err.Addf("Couldn't get runs for %v", id)
+	}
+
+	return runs, nil
+}
+
+//GetRun returns a single run of the caterpillar with the given id.
+func (h *Hatchery) GetRun(id string, runID int) (store.Run, *nerr.E) {
+	if !h.hasQueen(id) {
+		return store.Run{}, nerr.Create(fmt.Sprintf("No caterpillar with id %v", id), "not-found")
+	}
+
+	return store.GetRun(id, runID)
+}
+
+func (h *Hatchery) hasQueen(id string) bool {
+	for i := range h.Queens {
+		if h.Queens[i].config.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
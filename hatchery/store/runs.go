@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	ci "github.com/byuoitav/caterpillar/caterpillar/catinter"
+	"github.com/byuoitav/common/nerr"
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	//MaxRuns is the number of runs kept in each caterpillar's history, older runs are dropped.
+	MaxRuns = 100
+
+	//MaxRunErrors is the number of event errors kept for each run. ErrorCount still has the total.
+	MaxRunErrors = 100
+
+	runPrefix = "run-history/"
+)
+
+//Run is the report for a single run of a caterpillar.
+type Run struct {
+	ID          int       `json:"id"`
+	Caterpillar string    `json:"caterpillar"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+
+	//the window of events the feeder was asked for.
+	WindowStart time.Time `json:"window-start"`
+	WindowEnd   time.Time `json:"window-end"`
+
+	EventsCounted   int            `json:"events-counted"`
+	EventsProcessed int            `json:"events-processed"`
+	Records         map[string]int `json:"records"` //record type -> number emitted
+
+	Errors     []ci.EventError `json:"errors,omitempty"`
+	ErrorCount int             `json:"error-count"`
+
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+//AddErrors adds event errors to the run, only the first MaxRunErrors are kept.
+func (r *Run) AddErrors(errs []ci.EventError) {
+	r.ErrorCount += len(errs)
+	for _, e := range errs {
+		if len(r.Errors) >= MaxRunErrors {
+			return
+		}
+		r.Errors = append(r.Errors, e)
+	}
+}
+
+//PutRun adds the run to the history of caterpillar id, giving it the next run ID. The oldest runs are dropped once there are more than MaxRuns.
+func PutRun(id string, run Run) (Run, *nerr.E) {
+	once.Do(initializeStore)
+
+	err := db.Update(func(txn *badger.Txn) error {
+		runs, err := getRuns(txn, id)
+		if err != nil {
+			return err
+		}
+
+		run.ID = 1
+		if len(runs) > 0 {
+			run.ID = runs[len(runs)-1].ID + 1
+		}
+
+		runs = append(runs, run)
+		if len(runs) > MaxRuns {
+			runs = runs[len(runs)-MaxRuns:]
+		}
+
+		b, err := json.Marshal(runs)
+		if err != nil {
+			return err
+		}
+
+		return txn.Set([]byte(runPrefix+id), b)
+	})
+	if err != nil {
+		return run, nerr.Translate(err).Addf("Couldn't write run for %v to store", id)
+	}
+
+	return run, nil
+}
+
+//GetRuns returns the run history of caterpillar id, newest first.
+func GetRuns(id string) ([]Run, *nerr.E) {
+	once.Do(initializeStore)
+
+	var runs []Run
+	err := db.View(func(txn *badger.Txn) error {
+		var err error
+		runs, err = getRuns(txn, id)
+		return err
+	})
+	if err != nil {
+		return []Run{}, nerr.Translate(err).Addf("Couldn't get runs for %v from store", id)
+	}
+
+	toReturn := make([]Run, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		toReturn = append(toReturn, runs[i])
+	}
+
+	return toReturn, nil
+}
+
+//GetRun returns a single run of caterpillar id.
+func GetRun(id string, runID int) (Run, *nerr.E) {
+	runs, err := GetRuns(id)
+	if err != nil {
+		return Run{}, err
+	}
+
+	for _, r := range runs {
+		if r.ID == runID {
+			return r, nil
+		}
+	}
+
+	return Run{}, nerr.Create(fmt.Sprintf("No run %v for caterpillar %v", runID, id), "not-found")
+}
+
+//getRuns gets the stored runs, oldest first.
+func getRuns(txn *badger.Txn, id string) ([]Run, error) {
+	runs := []Run{}
+
+	item, err := txn.Get([]byte(runPrefix + id))
+	if err != nil {
+		if strings.Contains(err.Error(), "Key not found") {
+			return runs, nil
+		}
+		return runs, err
+	}
+
+	b, err := item.ValueCopy(nil)
+	if err != nil {
+		return runs, err
+	}
+
+	err = json.Unmarshal(b, &runs)
+	return runs, err
+}
@@ -0,0 +1,142 @@
+//Package metrics has the prometheus metrics for the hatchery, queens, feeders, and nydus network, served on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/byuoitav/common/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "caterpillar"
+
+//Results of a queen's run, for the result label of QueenRuns.
+const (
+	Success = "success"
+	Failure = "error"
+	Skipped = "skipped"
+)
+
+var (
+	//QueenRuns counts each queen's runs by result.
+	QueenRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queen_runs_total",
+		Help:      "Runs of each caterpillar, by result (success, error, or skipped if its config is invalid).",
+	}, []string{"caterpillar", "type", "result"})
+
+	//QueenRunDuration is how long each queen's runs take, including waiting on the feeder.
+	QueenRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queen_run_duration_seconds",
+		Help:      "How long each caterpillar's runs take.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14), // 1s to a bit over 2h
+	}, []string{"caterpillar", "type"})
+
+	//QueenLastSuccess is when each queen last finished a run without an error, so we can alert when one hasn't in a while,
+	//e.g. time() - caterpillar_queen_last_success_timestamp_seconds{caterpillar="core-state"} > 2 * 60 * 60
+	QueenLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queen_last_success_timestamp_seconds",
+		Help:      "Unix time each caterpillar last finished a run successfully.",
+	}, []string{"caterpillar", "type"})
+
+	//QueenRunning is 1 while a queen's caterpillar is running.
+	QueenRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queen_running",
+		Help:      "1 while the caterpillar is running.",
+	}, []string{"caterpillar", "type"})
+
+	//EventsFed counts the events fed to each caterpillar.
+	EventsFed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_fed_total",
+		Help:      "Events fed to each caterpillar.",
+	}, []string{"caterpillar"})
+
+	//RecordsEmitted counts the records each caterpillar generates, by record type.
+	RecordsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_emitted_total",
+		Help:      "Records generated by each caterpillar, by record type.",
+	}, []string{"caterpillar", "record_type"})
+
+	//MachineTransitions counts the transitions taken in each caterpillar's state machines.
+	MachineTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "machine_transitions_total",
+		Help:      "Transitions taken in each caterpillar's state machines.",
+	}, []string{"caterpillar", "machine", "from", "to"})
+
+	//FeederRequestDuration is how long the feeders' requests to ELK take, by operation (count or search).
+	FeederRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "feeder_elk_request_duration_seconds",
+		Help:      "Latency of the feeders' requests to ELK.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"caterpillar", "operation"})
+
+	//FeederRequestErrors counts the feeders' failed requests to ELK, by operation.
+	FeederRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feeder_elk_request_errors_total",
+		Help:      "Failed requests from the feeders to ELK.",
+	}, []string{"caterpillar", "operation"})
+
+	//NydusBatchSize is the number of records in each bulk update sent to ELK.
+	NydusBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "nydus_batch_size",
+		Help:      "Records in each bulk update the nydus network sends.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 13), // up to 4096, past the batch size
+	})
+
+	//NydusBulkFailures counts bulk updates that failed or came back with errors.
+	NydusBulkFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nydus_bulk_failures_total",
+		Help:      "Bulk updates to ELK that failed, or had records rejected.",
+	})
+
+	//NydusDroppedRecords counts records that never made it into ELK.
+	NydusDroppedRecords = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nydus_dropped_records_total",
+		Help:      "Records that couldn't be marshalled, were in a failed bulk update, or were rejected by ELK.",
+	})
+)
+
+//WatchNydus exposes the nydus network's channel and buffer. The functions are called each time the metrics are scraped.
+func WatchNydus(channelLength, channelCapacity, bufferLength func() float64) {
+	gauges := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "nydus_channel_length",
+			Help:      "Records waiting in the nydus network's channel.",
+		}, channelLength),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "nydus_channel_capacity",
+			Help:      "Capacity of the nydus network's channel.",
+		}, channelCapacity),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "nydus_buffer_length",
+			Help:      "Records buffered for the next bulk update.",
+		}, bufferLength),
+	}
+
+	for _, g := range gauges {
+		if err := prometheus.Register(g); err != nil {
+			log.L.Warnf("Couldn't register nydus metrics: %v", err.Error())
+		}
+	}
+}
+
+//Handler serves the metrics in the prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
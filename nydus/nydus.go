@@ -3,6 +3,7 @@ package nydus
 import (
 	"time"
 
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
 )
@@ -43,7 +44,13 @@ type HeaderIndex struct {
 
 //BulkUpdateResponse .
 type BulkUpdateResponse struct {
-	Errors bool `json:"errors"`
+	Errors bool                          `json:"errors"`
+	Items  []map[string]BulkItemResponse `json:"items"`
+}
+
+//BulkItemResponse is the result for one record in a bulk update, keyed by the action (e.g. index) in BulkUpdateResponse.
+type BulkItemResponse struct {
+	Status int `json:"status"`
 }
 
 //GetNetwork .
@@ -53,6 +60,12 @@ func GetNetwork() (*Network, *nerr.E) {
 		inChannel: make(chan BulkRecordEntry, bufferSize),
 	}
 
+	metrics.WatchNydus(
+		func() float64 { return float64(len(toReturn.inChannel)) },
+		func() float64 { return float64(cap(toReturn.inChannel)) },
+		func() float64 { return float64(len(toReturn.curBuffer)) },
+	)
+
 	//we'd start the network running.
 	go toReturn.run()
 
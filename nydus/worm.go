@@ -3,6 +3,7 @@ package nydus
 import (
 	"encoding/json"
 
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/state-parser/elk"
 )
@@ -13,20 +14,24 @@ const BatchSize = 2500
 //SpawnWorm is meant to be spanwed and forgotten, it handles the dispatching of the entries as a bulk update to ELK.
 func SpawnWorm(entries []BulkRecordEntry) {
 	log.L.Infof("Spawning worm. Sending %v records", len(entries))
+	metrics.NydusBatchSize.Observe(float64(len(entries)))
 
 	body := []byte{}
 	newline := []byte("\n")
+	sent := 0 //the entries in body, the ones that couldn't be marshalled are already counted as dropped.
 
 	for i := range entries {
 		hb, err := json.Marshal(entries[i].Header)
 		if err != nil {
 			log.L.Errorf("Couldn't marshal header %v", entries[i].Header)
+			metrics.NydusDroppedRecords.Inc()
 			continue
 		}
 
 		bb, err := json.Marshal(entries[i].Body)
 		if err != nil {
 			log.L.Errorf("Couldn't marshal body %v", entries[i].Body)
+			metrics.NydusDroppedRecords.Inc()
 			continue
 		}
 		
@@ -34,6 +39,7 @@ func SpawnWorm(entries []BulkRecordEntry) {
 		body = append(body, newline...)
 		body = append(body, bb...)
 		body = append(body, newline...)
+		sent++
 	}
 	//	log.L.Debugf("Sending body: %s", body)
 
@@ -41,18 +47,39 @@ func SpawnWorm(entries []BulkRecordEntry) {
 	resp, er := elk.MakeELKRequest("POST", "/_bulk", body)
 	if er != nil {
 		log.L.Errorf("Worm failed to send update: %v", er.Error())
+		metrics.NydusBulkFailures.Inc()
+		metrics.NydusDroppedRecords.Add(float64(sent))
 		return
 	}
 
 	var eresp BulkUpdateResponse
 	err := json.Unmarshal(resp, &eresp)
 	if err != nil {
+		//we can't tell which records made it, so they're all counted as dropped like a failed request.
 		log.L.Errorf("Uknown body receieved: %s, %v", resp, err.Error())
+		metrics.NydusBulkFailures.Inc()
+		metrics.NydusDroppedRecords.Add(float64(sent))
 		return
 	}
 	if eresp.Errors {
 		log.L.Errorf("Errors Received from Worm Bulk Request... %s", resp)
+		metrics.NydusBulkFailures.Inc()
+		metrics.NydusDroppedRecords.Add(float64(eresp.Rejected()))
 	}
 
 	return
 }
+
+//Rejected counts the records in the bulk update that ELK didn't accept.
+func (r BulkUpdateResponse) Rejected() int {
+	count := 0
+	for _, item := range r.Items {
+		for _, result := range item {
+			if result.Status/100 != 2 {
+				count++
+			}
+		}
+	}
+
+	return count
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"net/http"
+	"os"
+	"strconv"
 
+	sm "github.com/byuoitav/caterpillar/caterpillar/statemachine"
 	"github.com/byuoitav/caterpillar/hatchery"
+	"github.com/byuoitav/caterpillar/metrics"
 	"github.com/byuoitav/common/log"
 	"github.com/byuoitav/common/nerr"
 	"github.com/labstack/echo"
@@ -14,6 +18,10 @@ const port = ":10012"
 var hatch *hatchery.Hatchery
 
 func main() {
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	log.SetLevel("debug")
 	var err *nerr.E
 	hatch, err = hatchery.InitializeHatchery()
@@ -24,6 +32,12 @@ func main() {
 	router := echo.New()
 
 	router.GET("/status", getStatus)
+	router.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	router.GET("/caterpillars/:id/machine.dot", getMachineDiagram(sm.Dot))
+	router.GET("/caterpillars/:id/machine.svg", getMachineDiagram(sm.SVG))
+	router.GET("/caterpillars/:id/machine.mmd", getMachineDiagram(sm.Mermaid))
+	router.GET("/caterpillars/:id/runs", getRuns)
+	router.GET("/caterpillars/:id/runs/:runID", getRun)
 
 	server := http.Server{
 		Addr:           port,
@@ -40,3 +54,65 @@ func getStatus(context echo.Context) error {
 
 	return context.JSON(http.StatusOK, status)
 }
+
+//getMachineDiagram serves a diagram of a caterpillar's state machine. ?machine= picks the machine for caterpillars running more than one, ?counts=true overlays how many devices are in each node.
+func getMachineDiagram(format string) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		id := context.Param("id")
+		counts := context.QueryParam("counts") == "true"
+
+		b, err := hatch.GetMachineDiagram(id, context.QueryParam("machine"), format, counts)
+		if err != nil {
+			log.L.Warnf("Couldn't get machine diagram for %v: %v", id, err.Error())
+
+			switch err.Type {
+			case "not-found":
+				return context.String(http.StatusNotFound, err.Error())
+			case "not-machine":
+				return context.String(http.StatusBadRequest, err.Error())
+			}
+			return context.String(http.StatusInternalServerError, err.Error())
+		}
+
+		return context.Blob(http.StatusOK, hatchery.ContentType(format), b)
+	}
+}
+
+//getRuns serves the run history of a caterpillar, newest first.
+func getRuns(context echo.Context) error {
+	id := context.Param("id")
+
+	runs, err := hatch.GetRuns(id)
+	if err != nil {
+		log.L.Warnf("Couldn't get runs for %v: %v", id, err.Error())
+
+		if err.Type == "not-found" {
+			return context.String(http.StatusNotFound, err.Error())
+		}
+		return context.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return context.JSON(http.StatusOK, runs)
+}
+
+//getRun serves the report for a single run of a caterpillar.
+func getRun(context echo.Context) error {
+	id := context.Param("id")
+
+	runID, er := strconv.Atoi(context.Param("runID"))
+	if er != nil {
+		return context.String(http.StatusBadRequest, "Invalid run id "+context.Param("runID"))
+	}
+
+	run, err := hatch.GetRun(id, runID)
+	if err != nil {
+		log.L.Warnf("Couldn't get run %v for %v: %v", runID, id, err.Error())
+
+		if err.Type == "not-found" {
+			return context.String(http.StatusNotFound, err.Error())
+		}
+		return context.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return context.JSON(http.StatusOK, run)
+}
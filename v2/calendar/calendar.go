@@ -0,0 +1,105 @@
+package calendar
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// The exception types we tag records with. Sources can use others, they're passed through as is.
+const (
+	Holiday = "holiday"
+	Break   = "break"
+	Finals  = "finals"
+)
+
+var location *time.Location
+
+func init() {
+	var err error
+	location, err = time.LoadLocation("America/Denver")
+	if err != nil {
+		panic("unable to load timezone: " + err.Error())
+	}
+}
+
+// Exception is a run of days that aren't normal instructional days, e.g. a holiday or finals week.
+type Exception struct {
+	Start       time.Time // midnight at the start of the first day.
+	End         time.Time // midnight at the end of the last day.
+	Type        string
+	Description string
+}
+
+// Provider gets exception days from somewhere.
+type Provider interface {
+	Exceptions() ([]Exception, error)
+}
+
+// Calendar looks up which exception, if any, a time falls on.
+type Calendar struct {
+	exceptions []Exception
+}
+
+// New builds a calendar from the exceptions.
+func New(exceptions []Exception) *Calendar {
+	c := &Calendar{exceptions: make([]Exception, len(exceptions))}
+	copy(c.exceptions, exceptions)
+
+	sort.SliceStable(c.exceptions, func(i, j int) bool {
+		return c.exceptions[i].Start.Before(c.exceptions[j].Start)
+	})
+
+	return c
+}
+
+// Exception gets the exception t falls on. If exceptions overlap, e.g. a holiday during a break, the one that started last wins.
+func (c *Calendar) Exception(t time.Time) (Exception, bool) {
+	if c == nil {
+		return Exception{}, false
+	}
+
+	// the exceptions that start after t can't have it
+	i := sort.Search(len(c.exceptions), func(i int) bool {
+		return c.exceptions[i].Start.After(t)
+	})
+
+	for i--; i >= 0; i-- {
+		if t.Before(c.exceptions[i].End) {
+			return c.exceptions[i], true
+		}
+	}
+
+	return Exception{}, false
+}
+
+// ExceptionType gets the type of the exception t falls on, or "" if it's a normal day.
+func (c *Calendar) ExceptionType(t time.Time) string {
+	e, _ := c.Exception(t)
+	return e.Type
+}
+
+// Len is the number of exceptions in the calendar.
+func (c *Calendar) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.exceptions)
+}
+
+// day gets midnight at the start of the day, in Denver.
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, location)
+}
+
+// guessType picks an exception type from a description, for sources that don't have one.
+func guessType(description string) string {
+	d := strings.ToLower(description)
+	switch {
+	case strings.Contains(d, "final") || strings.Contains(d, "exam"):
+		return Finals
+	case strings.Contains(d, "break") || strings.Contains(d, "recess"):
+		return Break
+	}
+	return Holiday
+}
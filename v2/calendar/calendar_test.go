@@ -0,0 +1,118 @@
+package calendar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+)
+
+const testICS = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20191223
+DTEND;VALUE=DATE:20200101
+SUMMARY:Christmas Break
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20191225
+SUMMARY:Christmas
+CATEGORIES:Holiday
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20191216T080000Z
+DTEND:20191220T230000Z
+SUMMARY:Fall Semester Final
+ Exams
+END:VEVENT
+END:VCALENDAR
+`
+
+const testCSV = `start,end,type,description
+2019-11-27,2019-11-29,break,Thanksgiving
+2019-09-02,,holiday,Labor Day
+`
+
+func TestCalendar(t *testing.T) {
+	fromICS, err := ParseICS(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatalf("unable to parse ics: %v", err)
+	}
+	fromCSV, err := ParseCSV(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatalf("unable to parse csv: %v", err)
+	}
+
+	c := New(append(fromICS, fromCSV...))
+	if c.Len() != 5 {
+		t.Fatalf("expected 5 exceptions, got %v", c.Len())
+	}
+
+	at := func(month time.Month, d, hour int) time.Time {
+		return time.Date(2019, month, d, hour, 0, 0, 0, location)
+	}
+
+	for _, tt := range []struct {
+		t        time.Time
+		expected string
+	}{
+		{at(time.September, 2, 10), Holiday},
+		{at(time.September, 3, 0), ""},
+		{at(time.November, 26, 23), ""},
+		{at(time.November, 27, 0), Break},
+		{at(time.November, 29, 23), Break},
+		{at(time.November, 30, 0), ""},
+		{at(time.December, 16, 9), Finals},
+		{at(time.December, 20, 20), Finals},
+		{at(time.December, 24, 12), Break},
+		{at(time.December, 25, 12), Holiday},
+		{at(time.December, 31, 23), Break},
+		{time.Date(2020, time.January, 1, 0, 0, 0, 0, location), ""},
+	} {
+		if actual := c.ExceptionType(tt.t); actual != tt.expected {
+			t.Errorf("expected %v to be %q, got %q", tt.t, tt.expected, actual)
+		}
+	}
+
+	var empty *Calendar
+	if empty.ExceptionType(at(time.December, 25, 12)) != "" {
+		t.Errorf("expected a nil calendar to have no exceptions")
+	}
+}
+
+func TestSQLProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calendar")
+	if err != nil {
+		t.Fatalf("unable to make temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := metricssql.Config{Driver: metricssql.SQLite, ConnectionString: filepath.Join(dir, "metrics.db")}
+	db, err := metricssql.Open(config)
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO "ExceptionDates" ("ExceptionDate", "ExceptionType") VALUES (?, ?)`, "2019-09-02", "Holiday"); err != nil {
+		t.Fatalf("unable to add exception date: %v", err)
+	}
+
+	cal, err := Load("sql", config)
+	if err != nil {
+		t.Fatalf("unable to load calendar: %v", err)
+	}
+	if cal.ExceptionType(time.Date(2019, 9, 2, 12, 0, 0, 0, location)) != "holiday" {
+		t.Errorf("expected labor day to be a holiday")
+	}
+	if len(cal.ExceptionType(time.Date(2019, 9, 3, 12, 0, 0, 0, location))) != 0 {
+		t.Errorf("expected the day after to be a normal day")
+	}
+}
@@ -0,0 +1,159 @@
+package calendar
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseICS reads the events in an iCalendar file as exceptions. Each event covers the days from DTSTART up to DTEND.
+// The type comes from the event's first category, or is guessed from its summary.
+func ParseICS(r io.Reader) ([]Exception, error) {
+	// unfold lines; a line starting with a space or tab continues the one before it
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read ics: %w", err)
+	}
+
+	toReturn := []Exception{}
+	var cur *Exception
+	for i, line := range lines {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name, value := strings.ToUpper(line[:colon]), line[colon+1:]
+		if semi := strings.Index(name, ";"); semi >= 0 {
+			name = name[:semi]
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur = &Exception{}
+		case cur == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			if cur.Start.IsZero() {
+				return nil, fmt.Errorf("event ending on line %d has no DTSTART", i+1)
+			}
+			if !cur.End.After(cur.Start) {
+				cur.End = cur.Start.AddDate(0, 0, 1)
+			}
+			if len(cur.Type) == 0 {
+				cur.Type = guessType(cur.Description)
+			}
+			toReturn = append(toReturn, *cur)
+			cur = nil
+		case name == "DTSTART" || name == "DTEND":
+			t, err := parseICSDate(value, name == "DTEND")
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s on line %d: %w", name, i+1, err)
+			}
+			if name == "DTSTART" {
+				cur.Start = t
+			} else {
+				cur.End = t
+			}
+		case name == "SUMMARY":
+			cur.Description = unescapeICS(value)
+		case name == "CATEGORIES":
+			cur.Type = strings.ToLower(strings.TrimSpace(strings.Split(unescapeICS(value), ",")[0]))
+		}
+	}
+
+	return toReturn, nil
+}
+
+// parseICSDate gets the day of an ics DATE or DATE-TIME. Ends are exclusive, so an end partway through a day covers that day.
+func parseICSDate(value string, end bool) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("%q is too short to be a date", value)
+	}
+
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d := day(t.Year(), t.Month(), t.Day())
+	if end && len(value) > 8 && strings.Trim(value[8:], "T0Z") != "" {
+		d = d.AddDate(0, 0, 1)
+	}
+
+	return d, nil
+}
+
+func unescapeICS(value string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(value)
+}
+
+// ParseCSV reads exceptions from csv rows of start,end,type,description. Dates are YYYY-MM-DD, and end is the last day of the exception.
+// end can be left empty for a single day, and description is optional. A header row starting with "start" is skipped.
+func ParseCSV(r io.Reader) ([]Exception, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	toReturn := []Exception{}
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read csv: %w", err)
+		}
+
+		if row == 1 && strings.EqualFold(strings.TrimSpace(fields[0]), "start") {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("row %d has %d fields, need at least start,end,type", row, len(fields))
+		}
+
+		start, err := time.Parse("2006-01-02", strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid start on row %d: %w", row, err)
+		}
+
+		end := start
+		if len(strings.TrimSpace(fields[1])) > 0 {
+			end, err = time.Parse("2006-01-02", strings.TrimSpace(fields[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid end on row %d: %w", row, err)
+			}
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("row %d ends before it starts", row)
+		}
+
+		e := Exception{
+			Start: day(start.Year(), start.Month(), start.Day()),
+			End:   day(end.Year(), end.Month(), end.Day()+1),
+			Type:  strings.ToLower(strings.TrimSpace(fields[2])),
+		}
+		if len(fields) > 3 {
+			e.Description = strings.TrimSpace(fields[3])
+		}
+		if len(e.Type) == 0 {
+			e.Type = guessType(e.Description)
+		}
+
+		toReturn = append(toReturn, e)
+	}
+
+	return toReturn, nil
+}
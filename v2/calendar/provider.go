@@ -0,0 +1,171 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/common/log"
+)
+
+// RefreshInterval is how long a calendar loaded with Load is used before it's loaded again.
+var RefreshInterval = time.Hour
+
+// File reads exceptions from a local .ics or .csv file.
+type File struct {
+	Path string
+}
+
+// Exceptions fulfills the Provider interface.
+func (f File) Exceptions() ([]Exception, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open calendar: %w", err)
+	}
+	defer file.Close()
+
+	return parse(f.Path, file)
+}
+
+// URL downloads exceptions from a .ics or .csv file, e.g. a published university calendar.
+type URL struct {
+	URL string
+}
+
+// Exceptions fulfills the Provider interface.
+func (u URL) Exceptions() ([]Exception, error) {
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := client.Get(u.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unable to get calendar: %s", resp.Status)
+	}
+
+	name := strings.SplitN(u.URL, "?", 2)[0]
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/calendar") {
+		name = "calendar.ics"
+	}
+
+	return parse(name, resp.Body)
+}
+
+func parse(name string, r io.Reader) ([]Exception, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".ics", ".ical":
+		return ParseICS(r)
+	case ".csv":
+		return ParseCSV(r)
+	}
+
+	return nil, fmt.Errorf("unknown calendar format %q, must be .ics or .csv", name)
+}
+
+// SQL reads exceptions from the ExceptionDates table in the metrics database, one row for each day.
+type SQL struct {
+	Config metricssql.Config
+}
+
+// Exceptions fulfills the Provider interface.
+func (s SQL) Exceptions() ([]Exception, error) {
+	db, err := metricssql.Open(s.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows := []struct {
+		Date time.Time `db:"ExceptionDate"`
+		Type string    `db:"ExceptionType"`
+	}{}
+
+	q := `SELECT ` + db.Quote("ExceptionDate") + `, ` + db.Quote("ExceptionType") + ` FROM ` + db.Table("ExceptionDates")
+	if err := db.Select(&rows, q); err != nil {
+		return nil, fmt.Errorf("unable to get exception dates: %w", err)
+	}
+
+	toReturn := make([]Exception, 0, len(rows))
+	for _, row := range rows {
+		y, m, d := row.Date.Date()
+		toReturn = append(toReturn, Exception{
+			Start: day(y, m, d),
+			End:   day(y, m, d+1),
+			Type:  strings.ToLower(strings.TrimSpace(row.Type)),
+		})
+	}
+
+	return toReturn, nil
+}
+
+// ProviderFor gets the provider for a calendar source: "sql" for the ExceptionDates table in the metrics database sqlConfig connects to,
+// an http(s) url, or the path of a file. sqlConfig is only used for sql.
+func ProviderFor(source string, sqlConfig metricssql.Config) Provider {
+	switch {
+	case source == "sql":
+		return SQL{Config: sqlConfig}
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return URL{URL: source}
+	}
+
+	return File{Path: source}
+}
+
+type cached struct {
+	calendar *Calendar
+	loaded   time.Time
+}
+
+var (
+	cache   = map[string]cached{}
+	cacheMu sync.Mutex
+)
+
+// Load gets the calendar for a source (see ProviderFor), loading it at most once every RefreshInterval. An empty source is an empty calendar.
+// If reloading fails the calendar that was already loaded is kept; an error is only returned if it has never been loaded.
+func Load(source string, sqlConfig metricssql.Config) (*Calendar, error) {
+	source = strings.TrimSpace(source)
+	if len(source) == 0 {
+		return New(nil), nil
+	}
+
+	// each database has its own exceptions
+	key := source
+	if source == "sql" {
+		key = fmt.Sprintf("sql|%s|%s|%s", sqlConfig.Driver, sqlConfig.ConnectionString, sqlConfig.Schema)
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	c, ok := cache[key]
+	if ok && time.Since(c.loaded) < RefreshInterval {
+		return c.calendar, nil
+	}
+
+	exceptions, err := ProviderFor(source, sqlConfig).Exceptions()
+	if err != nil {
+		if ok {
+			log.L.Warnf("Unable to reload calendar %v, using the one from %v: %v", source, c.loaded.Format(time.RFC3339), err)
+			return c.calendar, nil
+		}
+		return nil, fmt.Errorf("unable to load calendar %s: %w", source, err)
+	}
+
+	log.L.Infof("Loaded %v calendar exceptions from %v", len(exceptions), source)
+	c = cached{calendar: New(exceptions), loaded: time.Now()}
+	cache[key] = c
+
+	return c.calendar, nil
+}
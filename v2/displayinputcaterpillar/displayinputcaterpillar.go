@@ -1,21 +1,24 @@
 package displayinputcaterpillar
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	mssql "github.com/denisenkom/go-mssqldb"
-
-	"github.com/byuoitav/caterpillar/v2/caterpillarmssql"
+	"github.com/byuoitav/caterpillar/v2/calendar"
 	"github.com/byuoitav/caterpillar/v2/elkquery"
+	"github.com/byuoitav/caterpillar/v2/inventory"
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/caterpillar/v2/schedule"
 	"github.com/byuoitav/common/log"
-	"github.com/byuoitav/wso2services/classschedules/uapiclassschedule"
+	"github.com/byuoitav/common/v2/events"
 )
 
 var byuLocation *time.Location
-var numOfRoomsToDoAtOnce = 10
 var maxLength = 250
 
 func init() {
@@ -48,6 +51,7 @@ type MetricsRecord struct {
 	StartTime         time.Time `json:"StartTime" db:"StartTime"`
 	EndTime           time.Time `json:"EndTime" db:"EndTime"`
 	ExceptionDateType string    `json:"ExceptionDateType" db:"ExceptionDateType"`
+	Shift             string    `json:"Shift" db:"Shift"`
 	StartHour         int       `json:"StartHour" db:"StartHour"`
 	StartDayOfWeek    int       `json:"StartDayOfWeek" db:"StartDayOfWeek"`
 	StartDay          int       `json:"StartDay" db:"StartDay"`
@@ -71,27 +75,140 @@ type MetricsRecord struct {
 	StatusDesc        string `json:"StatusDesc" db:"StatusDesc"`
 }
 
-func StartDisplayInputCaterpillar(building string) {
+// Config is the configuration for the display input caterpillar.
+type Config struct {
+	Buildings   []string          // the buildings to run when pulling events straight from ELK, see Run.
+	Workers     int               // the number of devices to process at once, defaults to 10.
+	SQL         metricssql.Config // how to connect to the database the records are stored in.
+	Table       string            // table the metrics records are stored in, defaults to DisplayInputMetrics.
+	EventsIndex string            // ELK index to pull events from, defaults to av-delta-events*.
+	Migrate     bool              // if true, any pending schema migrations are applied when connecting.
+	Calendar    string            // where to get holidays, breaks, etc. for ExceptionDateType from, see calendar.ProviderFor. none if empty.
+	Schedule    string            // where to get class schedules from, see schedule.ProviderFor. defaults to uapi.
+	Inventory   string            // where to get each device's room from, see inventory.ProviderFor. defaults to couch.
+	Slicing     string            // how records are sliced, see schedule.ParseSlicer. defaults to hourly,class.
+}
 
-	log.L.Debugf("Starting Display Input Caterpillar")
+// Caterpillar slices display state into metrics records and stores them in SQL.
+// The last known state of each device is kept in the LastKnownStates table, so it can pick up where it left off.
+type Caterpillar struct {
+	config    Config
+	db        *metricssql.DB
+	calendar  *calendar.Calendar
+	schedules schedule.Provider
+	slicer    schedule.Slicer
+}
+
+// Keys are the event keys the caterpillar looks at.
+var Keys = []string{"input", "power", "active-signal", "blanked"}
+
+// New connects to the database. Close the caterpillar when you're done with it.
+func New(config Config) (*Caterpillar, error) {
+	if len(config.Table) == 0 {
+		config.Table = "DisplayInputMetrics"
+	}
+	if len(config.EventsIndex) == 0 {
+		config.EventsIndex = "av-delta-events*"
+	}
+	if config.Workers < 1 {
+		config.Workers = defaultWorkers
+	}
+
+	if len(config.Schedule) == 0 {
+		config.Schedule = "uapi"
+	}
+	if len(config.Slicing) == 0 {
+		config.Slicing = "hourly,class"
+	}
+
+	slicer, err := schedule.ParseSlicer(config.Slicing)
+	if err != nil {
+		return nil, err
+	}
 
-	//get the value from SQL the last day we ran - we'll do the aggregation query back a month to make sure we got new ones
-	db, err := caterpillarmssql.GetDB()
-	defer db.Close()
+	cal, err := calendar.Load(config.Calendar, config.SQL)
 	if err != nil {
-		log.L.Debugf("UNABLE TO GET DB Connection")
-		log.L.Fatalf("Unable to get DB connection %v", err)
+		return nil, err
 	}
 
-	var lastKnownStateTime struct {
-		LastKnownStateTime time.Time `db:"LastKnownStateTime"`
+	schedules, err := schedule.Get(config.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := metricssql.Open(config.SQL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get db connection: %w", err)
+	}
+
+	config.SQL = db.Config
+
+	if config.Migrate {
+		applied, err := db.Migrate()
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to migrate db: %w", err)
+		}
+		log.L.Infof("Applied %v migrations", len(applied))
+	}
+
+	// the pool is shared by all of the workers. each device holds a connection for its transaction, with room to spare for reading last known states.
+	if config.SQL.Driver != metricssql.SQLite {
+		db.SetMaxOpenConns(2 * config.Workers)
+		db.SetMaxIdleConns(config.Workers)
+	}
+
+	return &Caterpillar{
+		config:    config,
+		db:        db,
+		calendar:  cal,
+		schedules: schedules,
+		slicer:    slicer,
+	}, nil
+}
+
+// Close closes the database connection.
+func (c *Caterpillar) Close() error {
+	return c.db.Close()
+}
+
+// StartDisplayInputCaterpillar runs the caterpillar for a single building, pulling events straight from ELK.
+func StartDisplayInputCaterpillar(building string) error {
+	log.L.Debugf("Starting Display Input Caterpillar")
+
+	c, err := New(Config{Buildings: []string{building}})
+	if err != nil {
+		return err
 	}
-	err = db.Get(&lastKnownStateTime, "SELECT isnull(min(LastKnownStateTime), '1/1/1980') as LastKnownStateTime from LastKnownStates")
+	defer c.Close()
+
+	summary, err := c.Run()
+	log.L.Infof("Display input caterpillar run for %v: %v", building, summary)
 	if err != nil {
-		log.L.Debugf("Unable to get min last known state time")
-		log.L.Fatalf("Unable to get min last known state time %v", err)
+		return err
 	}
 
+	return summary.Err()
+}
+
+// Run pulls the events for each device in the configured buildings from ELK and processes them.
+// Failures on individual devices are in the summary, the error is only for failures that stop the whole run.
+func (c *Caterpillar) Run() (Summary, error) {
+	summary := Summary{}
+
+	for _, building := range c.config.Buildings {
+		s, err := c.RunBuilding(building)
+		summary.Add(s)
+		if err != nil {
+			return summary, fmt.Errorf("unable to run building %s: %w", building, err)
+		}
+	}
+
+	return summary, nil
+}
+
+// RunBuilding pulls the events for each device in the building from ELK and processes them.
+func (c *Caterpillar) RunBuilding(building string) (Summary, error) {
 	//run the aggregation query to get the list of devices
 	q := `
 	{
@@ -136,87 +253,42 @@ func StartDisplayInputCaterpillar(building string) {
 	q = strings.ReplaceAll(q, "$STARTDATE", "2017-01-01")
 	q = strings.ReplaceAll(q, "$BUILDING", building)
 
-	// fmt.Printf("TEST: %v", q)
-
 	query, nerr := elkquery.GetQueryTemplateFromString([]byte(q))
 	if nerr != nil {
-		log.L.Fatalf("Unable to translate query string %v", nerr)
+		return Summary{}, fmt.Errorf("unable to translate query string: %s", nerr.Error())
 	}
 
-	response, nerr := elkquery.ExecuteElkQuery("av-delta-events*", query)
+	response, nerr := elkquery.ExecuteElkQuery(c.config.EventsIndex, query)
 	if nerr != nil {
-		log.L.Debugf("Error executing query")
-		log.L.Fatalf("Error executing query %v", nerr)
+		return Summary{}, fmt.Errorf("error executing query: %s", nerr.Error())
 	}
 	log.L.Debugf("Passed ELKQUERY")
 	var responseAggs deviceAggregations
 	x, _ := json.Marshal(response.Aggregations)
-	err = json.Unmarshal(x, &responseAggs)
+	err := json.Unmarshal(x, &responseAggs)
 	if err != nil {
-		log.L.Debugf("Unable to convert device aggs")
-		log.L.Fatalf("Unable to convert device aggs")
+		return Summary{}, fmt.Errorf("unable to convert device aggs: %w", err)
 	}
 	log.L.Debugf("Passed aggregation")
 	log.L.Debugf("Devices: %v", responseAggs.Devices)
+
 	// process each device
+	devices := []string{}
 	for _, bucket := range responseAggs.Devices.Buckets {
-		log.L.Debugf("Bucket Key: %v", bucket.Key)
-		caterpillarDevice(bucket.Key)
+		devices = append(devices, bucket.Key)
 	}
-}
 
-func caterpillarDevice(deviceName string) {
-	//Get from SQL the last state known
-	db, err := caterpillarmssql.GetDB()
-	if err != nil {
-		log.L.Debugf("Unable to get db working on device")
-		log.L.Errorf("Unable to get db working on device %v: %v", deviceName, err.Error())
-		return
-	}
-	defer db.Close()
-	log.L.Debugf("Into the Caterpillar Device function")
-	lastKnownStateQuery :=
-		`SELECT *
-		from LastKnownStates
-		where DeviceID = @p1`
+	return c.runPool(devices, c.runDevice), nil
+}
 
-	var myLastKnownState lastKnownState
-	var myLastKnownStateSlice []lastKnownState
+// scrollKeepAlive is how long ELK holds a device's events query open between pages.
+const scrollKeepAlive = "1m"
 
-	err = db.Select(&myLastKnownStateSlice, lastKnownStateQuery, deviceName)
+// runDevice pulls the events for a device from ELK, starting at its last known state.
+func (c *Caterpillar) runDevice(deviceName string) (int, error) {
+	lks, currentState, err := c.getLastKnownState(deviceName)
 	if err != nil {
-		log.L.Errorf("Unable to get last known state of device %v: %v", deviceName, err.Error())
-		return
-	}
-
-	if len(myLastKnownStateSlice) == 0 {
-		//create new
-		myLastKnownState = lastKnownState{
-			DeviceID:           deviceName,
-			LastKnownStateJSON: "",
-		}
-	} else {
-		myLastKnownState = myLastKnownStateSlice[0]
-	}
-
-	//unmarshal from the DB into an object
-	var currentState MetricsRecord
-
-	if len(myLastKnownState.LastKnownStateJSON) > 0 {
-		json.Unmarshal([]byte(myLastKnownState.LastKnownStateJSON), &currentState)
-	} else {
-		roomParts := strings.Split(deviceName, "-")
-		currentState = MetricsRecord{
-			DeviceID:          deviceName,
-			RoomID:            roomParts[0] + "-" + roomParts[1],
-			BuildingID:        roomParts[0],
-			DeviceIDPrefix:    strings.TrimRight(roomParts[2], "0123456789"),
-			Power:             "unknown",
-			Blanked:           "unknown",
-			InputType:         "unknown",
-			Input:             "unknown",
-			InputActiveSignal: "unknown",
-		}
+		return 0, err
 	}
 
 	//Get all events from delta since that date
@@ -255,55 +327,186 @@ func caterpillarDevice(deviceName string) {
 
 	query, nerr := elkquery.GetQueryTemplateFromString([]byte(getEventsQuery))
 	if nerr != nil {
-		log.L.Debugf("UNABLE TO TRANSLATE")
-		log.L.Fatalf("Unable to translate get events query %v", nerr)
-
+		return 0, fmt.Errorf("unable to translate get events query: %s", nerr.Error())
 	}
 
+	// page through every event since the last known state so the device is caught all the way up in one run.
 	log.L.Debugf("Executing elk query for %v", deviceName)
-	response, nerr := elkquery.ExecuteElkQuery("av-delta-events*", query)
+	evs := []events.Event{}
+	nerr = elkquery.ScrollElkQuery(c.config.EventsIndex, query, scrollKeepAlive, func(response elkquery.QueryResponse) error {
+		for _, hit := range response.Hits.Hits {
+			evs = append(evs, hit.Source)
+		}
+		return nil
+	})
 	if nerr != nil {
-		log.L.Debugf("UNABLE TO EXECUTE EVENT QUERY")
-		log.L.Fatalf("Error executing events query for %v: %v", deviceName, nerr)
+		return 0, fmt.Errorf("error executing events query: %s", nerr.Error())
+	}
+
+	return c.processDevice(lks, currentState, evs, time.Time{})
+}
+
+// ProcessDevices processes events for each device that were pulled by someone else, e.g. a hatchery feeder. See ProcessDeviceEvents.
+func (c *Caterpillar) ProcessDevices(devices map[string][]events.Event, end time.Time) Summary {
+	ids := []string{}
+	for k := range devices {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+
+	return c.runPool(ids, func(id string) (int, error) {
+		return c.ProcessDeviceEvents(id, devices[id], end)
+	})
+}
+
+// ProcessDeviceEvents processes events for a device that were pulled by someone else. Events must be in order, and any
+// at or before the device's last known state are skipped. end is the end of the time the events were pulled for, the device's
+// state isn't carried past it. Returns the number of records written.
+func (c *Caterpillar) ProcessDeviceEvents(deviceName string, evs []events.Event, end time.Time) (int, error) {
+	lks, currentState, err := c.getLastKnownState(deviceName)
+	if err != nil {
+		return 0, err
 	}
 
+	toProcess := []events.Event{}
+	for _, e := range evs {
+		if e.Timestamp.After(currentState.StartTime) {
+			toProcess = append(toProcess, e)
+		}
+	}
+
+	return c.processDevice(lks, currentState, toProcess, end)
+}
+
+// getLastKnownState gets the device's last known state from SQL. If there isn't one, a blank state is returned.
+func (c *Caterpillar) getLastKnownState(deviceName string) (lastKnownState, MetricsRecord, error) {
+	log.L.Debugf("Into the Caterpillar Device function")
+	lastKnownStateQuery := c.db.Rebind(
+		`SELECT *
+		from ` + c.db.Table("LastKnownStates") + `
+		where ` + c.db.Quote("DeviceID") + ` = ?`)
+
+	var myLastKnownState lastKnownState
+	var myLastKnownStateSlice []lastKnownState
+
+	err := c.db.Select(&myLastKnownStateSlice, lastKnownStateQuery, deviceName)
+	if err != nil {
+		return myLastKnownState, MetricsRecord{}, fmt.Errorf("unable to get last known state: %w", err)
+	}
+
+	if len(myLastKnownStateSlice) == 0 {
+		//create new
+		myLastKnownState = lastKnownState{
+			DeviceID:           deviceName,
+			LastKnownStateJSON: "",
+		}
+	} else {
+		myLastKnownState = myLastKnownStateSlice[0]
+	}
+
+	//unmarshal from the DB into an object
+	var currentState MetricsRecord
+
+	if len(myLastKnownState.LastKnownStateJSON) > 0 {
+		err = json.Unmarshal([]byte(myLastKnownState.LastKnownStateJSON), &currentState)
+		if err != nil {
+			return myLastKnownState, currentState, fmt.Errorf("unable to unmarshal last known state: %w", err)
+		}
+	} else {
+		roomParts := strings.Split(deviceName, "-")
+		if len(roomParts) < 3 {
+			return myLastKnownState, currentState, fmt.Errorf("invalid device id %s", deviceName)
+		}
+
+		device, err := c.device(deviceName)
+		if err != nil {
+			return myLastKnownState, currentState, err
+		}
+
+		currentState = MetricsRecord{
+			DeviceID:          deviceName,
+			RoomID:            device.RoomID(),
+			BuildingID:        device.BuildingID(),
+			DeviceIDPrefix:    strings.TrimRight(roomParts[2], "0123456789"),
+			Power:             "unknown",
+			Blanked:           "unknown",
+			InputType:         "unknown",
+			Input:             "unknown",
+			InputActiveSignal: "unknown",
+		}
+	}
+
+	return myLastKnownState, currentState, nil
+}
+
+// device gets a device from the inventory. If the device isn't in it, its room and building come from its id.
+func (c *Caterpillar) device(deviceName string) (inventory.Device, error) {
+	inv, err := inventory.Get(c.config.Inventory)
+	if err != nil {
+		return inventory.Device{}, err
+	}
+
+	if d, ok := inv.Device(deviceName); ok {
+		return d, nil
+	}
+
+	log.L.Debugf("%v isn't in the inventory, using its id for its room", deviceName)
+	return inventory.Device{ID: deviceName}, nil
+}
+
+// processDevice slices the device's state from its last known state through each of the events, stores the records, and updates the last known state.
+// evs must be all of the events for the device from its last known state to end, since its state is carried up to the last whole hour before end
+// (or more than an hour ago if end is zero). Returns the number of records written.
+// The delete, the inserts, and the last known state update are done in one transaction, so if any of them fail the device is left as it was.
+func (c *Caterpillar) processDevice(myLastKnownState lastKnownState, currentState MetricsRecord, evs []events.Event, end time.Time) (int, error) {
+	deviceName := myLastKnownState.DeviceID
+
+	txn, err := c.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("unable to start txn: %w", err)
+	}
+	defer txn.Rollback() // does nothing once committed
+
 	//Delete anything in SQL / Kibana that is older than the date we're starting at (so if we're redoing we don't have to worry about duplicates)
 	if !myLastKnownState.LastKnownStateTime.IsZero() {
 		log.L.Debugf("Removing future records for %v after %v", deviceName, myLastKnownState.LastKnownStateTime)
-		deleteQuery :=
+		deleteQuery := c.db.Rebind(
 			`DELETE
-		FROM DisplayInputMetrics
-		WHERE DeviceID = @p1 and StartTime >= @p2`
-
-		sqlResult, err := db.Exec(deleteQuery, deviceName, myLastKnownState.LastKnownStateTime)
+		FROM ` + c.db.Table(c.config.Table) + `
+		WHERE ` + c.db.Quote("DeviceID") + ` = ? and ` + c.db.Quote("StartTime") + ` >= ?`)
 
+		sqlResult, err := txn.Exec(deleteQuery, deviceName, myLastKnownState.LastKnownStateTime)
 		if err != nil {
-			log.L.Errorf("Unable to remove future Metrics records for %v: %v", deviceName, err.Error())
-			return
+			return 0, fmt.Errorf("unable to remove future metrics records: %w", err)
 		}
 
 		rowsAffected, err := sqlResult.RowsAffected()
-
 		if err != nil {
-			log.L.Errorf("Unable to get rows affected for %v: %v", deviceName, err.Error())
-			return
+			return 0, fmt.Errorf("unable to get rows affected: %w", err)
 		}
 
 		log.L.Debugf("Removed %v rows for %v", rowsAffected, deviceName)
 	}
 
-	log.L.Debugf("Found %v events for %v", len(response.Hits.Hits), deviceName)
+	log.L.Debugf("Found %v events for %v", len(evs), deviceName)
 
 	//start up a storage channel
 	storeChannel := make(chan MetricsRecord, 100)
 	var storageWaitGroup sync.WaitGroup
 	storageWaitGroup.Add(1)
 
-	go storeRecord(storeChannel, &storageWaitGroup)
+	var stored int
+	var storeErr error
+	go func() {
+		stored, storeErr = c.storeRecord(txn, storeChannel, &storageWaitGroup)
+	}()
 
+	var sliceErr error
 	realEventCount := 0
-	for _, oneEvent := range response.Hits.Hits {
-		src := oneEvent.Source
+	for _, src := range evs {
+		if sliceErr != nil {
+			break
+		}
 		if len(src.Value) == 0 {
 			continue
 		}
@@ -323,7 +526,7 @@ func caterpillarDevice(deviceName string) {
 			copyOfCurrent.ElapsedSeconds = int(copyOfCurrent.EndTime.Sub(copyOfCurrent.StartTime).Seconds())
 
 			//send to slicer
-			sliceRecord(copyOfCurrent, storeChannel)
+			sliceErr = c.sliceRecord(copyOfCurrent, storeChannel)
 		}
 
 		//now update the current state
@@ -351,15 +554,14 @@ func caterpillarDevice(deviceName string) {
 		}
 	}
 
-	if realEventCount == 0 {
-		return
-	}
-
-	if response.Hits.Total == len(response.Hits.Hits) {
-		//Update the current state record to be up to the latest whole hour that is more than an hour old
+	if realEventCount > 0 && sliceErr == nil {
+		//Update the current state record to be up to the latest whole hour that is more than an hour old, and not past the end of the events
 		lastHourEnd := time.Now()
 		lastHourEnd = lastHourEnd.Truncate(time.Hour)
 		lastHourEnd = lastHourEnd.Add(-1 * time.Hour)
+		if !end.IsZero() && end.Before(lastHourEnd) {
+			lastHourEnd = end.Truncate(time.Hour)
+		}
 
 		if currentState.StartTime.Before(lastHourEnd) {
 			//update and then send to the slicer
@@ -370,7 +572,7 @@ func caterpillarDevice(deviceName string) {
 			copyOfCurrent.ElapsedSeconds = int(copyOfCurrent.EndTime.Sub(copyOfCurrent.StartTime).Seconds())
 
 			//send to slicer - function that gets the class schedule
-			sliceRecord(copyOfCurrent, storeChannel)
+			sliceErr = c.sliceRecord(copyOfCurrent, storeChannel)
 
 			currentState.StartTime = lastHourEnd
 		}
@@ -383,282 +585,219 @@ func caterpillarDevice(deviceName string) {
 	//wait for all storage routines to finish
 	storageWaitGroup.Wait()
 
-	//update last state known in sql
-	lastKnownStateUpdateQuery :=
-		`EXEC UpdateLastKnownState @p1, @p2, @p3`
-
-	lastKnownStateJSON, err := json.Marshal(currentState)
+	if sliceErr != nil {
+		return 0, fmt.Errorf("unable to slice records: %w", sliceErr)
+	}
+	if storeErr != nil {
+		return 0, fmt.Errorf("unable to store records: %w", storeErr)
+	}
 
-	if err == nil {
-		_, err = db.Exec(lastKnownStateUpdateQuery, deviceName, currentState.StartTime, string(lastKnownStateJSON))
+	if realEventCount > 0 {
+		//update last state known in sql
+		lastKnownStateJSON, err := json.Marshal(currentState)
+		if err != nil {
+			return 0, fmt.Errorf("unable to marshal last known state: %w", err)
+		}
 
+		err = c.db.UpsertLastKnownState(txn, deviceName, currentState.StartTime, string(lastKnownStateJSON))
 		if err != nil {
-			log.L.Errorf("Unable to update last known state for %v: %v", deviceName, err.Error())
+			return 0, fmt.Errorf("unable to update last known state: %w", err)
 		}
 	}
-}
 
-func timeBetween(t, from, to time.Time) bool {
-	return t.After(from) && t.Before(to)
-}
+	if err := txn.Commit(); err != nil {
+		return 0, fmt.Errorf("unable to commit txn: %w", err)
+	}
 
-func truncateDateOnlyWithTimezone(toRound time.Time) time.Time {
-	rounded := time.Date(toRound.Year(), toRound.Month(), toRound.Day(), 0, 0, 0, 0, toRound.Location())
-	return rounded
+	return stored, nil
 }
 
-func sliceRecord(recordToSlice MetricsRecord, storeChannel chan MetricsRecord) {
-	//for this record, get the class schedules from the memory cache (or WSO2 if not pulled yet)
-	//get all the classes for the whole day so we don't have to hit it a bunch
-	debugTime, _ := time.Parse(time.RFC822, "05 Feb 20 06:00 UTC")
-
-	classScheduleDate := truncateDateOnlyWithTimezone(recordToSlice.StartTime.In(byuLocation))
-	classSchedules, _ := uapiclassschedule.GetSimpleClassSchedulesForRoomAndDate(recordToSlice.RoomID, classScheduleDate)
-
-	if recordToSlice.EndTime.After(debugTime) {
-		log.L.Debugf("Start time = " + recordToSlice.StartTime.String())
-		log.L.Debugf("Start time (BYU) = " + recordToSlice.StartTime.In(byuLocation).String())
-		log.L.Debugf("%v classes found for date %s", len(classSchedules), classScheduleDate.String())
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
 	}
+	return s
+}
 
-	//slice up the record on each hour, as well as class schedule boundaries
-	for {
-		//see if we have crossed to a different day
-		checkDate := truncateDateOnlyWithTimezone(recordToSlice.StartTime.In(byuLocation))
-		if checkDate != classScheduleDate {
-			classScheduleDate := truncateDateOnlyWithTimezone(recordToSlice.StartTime.In(byuLocation))
-			classSchedules, _ = uapiclassschedule.GetSimpleClassSchedulesForRoomAndDate(recordToSlice.RoomID, classScheduleDate)
-			//log.L.Debugf("%v classes found for %s", len(classSchedules), classScheduleDate.String())
-		}
-
-		//determine the hour end time
-		hourEndTime := recordToSlice.StartTime.Truncate(time.Hour).Add(time.Hour)
-		//log.L.Debugf("Initial end time %v", hourEndTime)
-		if hourEndTime.After(recordToSlice.EndTime) {
-			hourEndTime = recordToSlice.EndTime
-		}
+func timeBetween(t, from, to time.Time) bool {
+	return t.After(from) && t.Before(to)
+}
 
-		//assume no class unless we find one
-		recordToSlice.IsClass = false
-		recordToSlice.TeachingArea = ""
-		recordToSlice.CourseNumber = ""
-		recordToSlice.SectionNumber = ""
-		recordToSlice.ClassName = ""
-		recordToSlice.ScheduleType = ""
-		recordToSlice.InstructorName = ""
+// sliceRecord slices the record with the configured slicer (by default on each hour and class boundary), and sends the slices to the storage channel.
+// Sections that meet at the same time (e.g. cross-listed courses) share a slice with their info combined, see schedule.Composite.
+// If the class schedule can't be loaded nothing is sent and the error is returned, so the device is rolled back and tried again rather than stored without class info.
+func (c *Caterpillar) sliceRecord(recordToSlice MetricsRecord, storeChannel chan MetricsRecord) error {
+	classes, err := schedule.Classes(c.schedules, recordToSlice.RoomID, recordToSlice.StartTime, recordToSlice.EndTime)
+	if err != nil {
+		return fmt.Errorf("unable to get class schedule: %w", err)
+	}
 
+	for _, slice := range c.slicer.Slice(recordToSlice.StartTime, recordToSlice.EndTime, classes) {
 		copy := recordToSlice
-
-		//see if we have any classes that have a start date or end date between our start and end time - if we do, that becomes the new end time
-		for _, classSchedule := range classSchedules {
-
-			if classSchedule.StartDateTime.After(hourEndTime) {
-				continue
-			}
-
-			//see if we need to adjust the time of this slice
-			if classSchedule.StartDateTime.Before(hourEndTime) &&
-				classSchedule.StartDateTime.After(recordToSlice.StartTime) &&
-				classSchedule.StartDateTime.Before(recordToSlice.EndTime) {
-				//there is a class that starts in the middle of our block
-				//so that becomes our new end time for the block
-				hourEndTime = classSchedule.StartDateTime
-				//log.L.Debugf("New end time - start of a class %v", hourEndTime)
-
-			} else if classSchedule.EndDateTime.Before(hourEndTime) &&
-				classSchedule.EndDateTime.After(recordToSlice.StartTime) &&
-				classSchedule.EndDateTime.Before(recordToSlice.EndTime) {
-				//there is class that ends in the middle of our block, but started before
-				hourEndTime = classSchedule.EndDateTime
-				//log.L.Debugf("New end time - end of a class %v", hourEndTime)
-			}
-
-			//now see if this slice is part of the class or not
-			if (classSchedule.StartDateTime.Equal(recordToSlice.StartTime) ||
-				classSchedule.StartDateTime.Before(recordToSlice.StartTime)) &&
-				(classSchedule.EndDateTime.Equal(hourEndTime) ||
-					classSchedule.EndDateTime.After(hourEndTime)) {
-				//the whole block is in our class
-				recordToSlice.IsClass = true
-				recordToSlice.TeachingArea = classSchedule.TeachingArea
-				recordToSlice.CourseNumber = classSchedule.CourseNumber
-				recordToSlice.SectionNumber = classSchedule.SectionNumber
-				recordToSlice.ClassName = classSchedule.TeachingArea + " " + classSchedule.CourseNumber
-				recordToSlice.ScheduleType = classSchedule.ScheduleType
-				recordToSlice.InstructorName = strings.Join(classSchedule.InstructorNames, "|")
-
-				copy = recordToSlice
-			}
-		}
-
-		//log.L.Debugf("Final end time for copy %v", hourEndTime)
-		copy.EndTime = hourEndTime
-		copy.StartTime = copy.StartTime.In(byuLocation)
-		copy.EndTime = copy.EndTime.In(byuLocation)
+		copy.StartTime = slice.Start.In(byuLocation)
+		copy.EndTime = slice.End.In(byuLocation)
 		copy.ElapsedSeconds = int(copy.EndTime.Sub(copy.StartTime).Seconds())
 		copy.StartHour = copy.StartTime.Hour()
 		copy.StartDayOfWeek = int(copy.StartTime.Weekday())
 		copy.StartDay = int(copy.StartTime.Day())
 		copy.StartMonth = int(copy.StartTime.Month())
 		copy.StartYear = copy.StartTime.Year()
+		copy.ExceptionDateType = c.calendar.ExceptionType(copy.StartTime)
+		copy.Shift = slice.Shift
 
-		//send the sliced record to the storage go routine
-		storeChannel <- copy
-
-		//stop if we've done all of it
-		if hourEndTime.Equal(recordToSlice.EndTime) {
-			break
+		//assume no class unless we find one
+		copy.IsClass = false
+		copy.TeachingArea = ""
+		copy.CourseNumber = ""
+		copy.SectionNumber = ""
+		copy.ClassName = ""
+		copy.ScheduleType = ""
+		copy.InstructorName = ""
+
+		if class, ok := slice.Composite(); ok {
+			copy.IsClass = true
+			copy.TeachingArea = class.TeachingArea
+			copy.CourseNumber = class.CourseNumber
+			copy.SectionNumber = class.SectionNumber
+			copy.ClassName = class.TeachingArea + " " + class.CourseNumber
+			copy.ScheduleType = class.ScheduleType
+			copy.InstructorName = strings.Join(class.Instructors, "|")
 		}
 
-		//update and loop
-		recordToSlice.StartTime = hourEndTime
+		//send the sliced record to the storage go routine
+		storeChannel <- copy
 	}
+
+	return nil
 }
 
-func storeRecord(storeChannel chan MetricsRecord, wg *sync.WaitGroup) {
+// storeRecord stores the records coming down the channel in batches in txn. Once there's been an error the rest of the records are drained and dropped.
+// Returns the number of records stored.
+func (c *Caterpillar) storeRecord(txn *sql.Tx, storeChannel chan MetricsRecord, wg *sync.WaitGroup) (int, error) {
 	defer wg.Done()
 
 	var RecordsToStore []MetricsRecord
+	var err error
+	stored := 0
+	n := 0
 
 	//wait for something to come down the channel
-	for {
-		recordToStore, more := <-storeChannel
-
-		if more {
-			RecordsToStore = append(RecordsToStore, recordToStore)
-			//do them 5000 at a time
-			if len(RecordsToStore) > 5000 {
-				bulkInsertToSQL(RecordsToStore)
-				//clear it out
-				RecordsToStore = []MetricsRecord{}
-			}
-		} else {
-			break
+	for recordToStore := range storeChannel {
+		if err != nil {
+			continue
+		}
+
+		RecordsToStore = append(RecordsToStore, recordToStore)
+		//do them 5000 at a time
+		if len(RecordsToStore) > 5000 {
+			n, err = c.bulkInsertToSQL(txn, RecordsToStore)
+			stored += n
+			//clear it out
+			RecordsToStore = []MetricsRecord{}
 		}
 	}
 
 	//do the bulk insert
-	if len(RecordsToStore) > 0 {
-		bulkInsertToSQL(RecordsToStore)
+	if err == nil && len(RecordsToStore) > 0 {
+		n, err = c.bulkInsertToSQL(txn, RecordsToStore)
+		stored += n
 	}
+
+	return stored, err
 }
 
-func bulkInsertToSQL(recordsToStore []MetricsRecord) {
+func (c *Caterpillar) bulkInsertToSQL(txn *sql.Tx, recordsToStore []MetricsRecord) (int, error) {
 
 	log.L.Debugf("storing  %v records to SQL for device %v",
 		len(recordsToStore), recordsToStore[0].DeviceID)
 
-	db, err := caterpillarmssql.GetRawDB()
-	defer db.Close()
-	if err != nil {
-		log.L.Debugf("Unable to get raw db to store records on device %v: %v", recordsToStore[0].DeviceID, err.Error())
-		return
-	}
-
-	txn, err := db.Begin()
-
-	if err != nil {
-		log.L.Debugf("Unable to start txn to store records on device %v: %v", recordsToStore[0].DeviceID, err.Error())
-		return
-	}
-
-	stmt, err := txn.Prepare(mssql.CopyIn("DisplayInputMetrics", mssql.BulkOptions{},
-		"DeviceID",
-		"RoomID",
-		"BuildingID",
-		"DeviceIDPrefix",
-		"StartTime",
-		"EndTime",
-		"ExceptionDateType",
-		"StartHour",
-		"StartDayOfWeek",
-		"StartDay",
-		"StartMonth",
-		"StartYear",
-		"ElapsedSeconds",
-		"IsClass",
-		"TeachingArea",
-		"CourseNumber",
-		"SectionNumber",
-		"ClassName",
-		"ScheduleType",
-		"InstructorName",
-		"Power",
-		"Blanked",
-		"InputType",
-		"Input",
-		"InputActiveSignal",
-		"StatusDesc",
-	))
-
-	if err != nil {
-		log.L.Errorf("Unable to start copy in to store records on device %v: %v", recordsToStore[0].DeviceID, err.Error())
-		return
-	}
-
-	for i, recordToStore := range recordsToStore {
+	rows := make([][]interface{}, 0, len(recordsToStore))
+	for _, recordToStore := range recordsToStore {
 		if len(recordToStore.InstructorName) > maxLength {
 			log.L.Debugf("Instructor Name is too long for SQL Field: %v", recordToStore.InstructorName)
 			recordToStore.InstructorName = recordToStore.InstructorName[:maxLength]
 			log.L.Debugf("Instructor Name has been shortened to 250 characters")
 		}
-		_, err = stmt.Exec(
-			recordToStore.DeviceID,
-			recordToStore.RoomID,
-			recordToStore.BuildingID,
-			recordToStore.DeviceIDPrefix,
-			recordToStore.StartTime,
-			recordToStore.EndTime,
-			recordToStore.ExceptionDateType,
-			recordToStore.StartHour,
-			recordToStore.StartDayOfWeek,
-			recordToStore.StartDay,
-			recordToStore.StartMonth,
-			recordToStore.StartYear,
-			recordToStore.ElapsedSeconds,
-			recordToStore.IsClass,
-			recordToStore.TeachingArea,
-			recordToStore.CourseNumber,
-			recordToStore.SectionNumber,
-			recordToStore.ClassName,
-			recordToStore.ScheduleType,
-			recordToStore.InstructorName,
-			recordToStore.Power,
-			recordToStore.Blanked,
-			recordToStore.InputType,
-			recordToStore.Input,
-			recordToStore.InputActiveSignal,
-			recordToStore.StatusDesc,
-		)
-
-		if err != nil {
-			log.L.Errorf("db error when storing record %v on device %v: %v", i, recordToStore.DeviceID, err.Error())
-		}
-	}
-
-	result, err := stmt.Exec()
-
-	if err != nil {
-		log.L.Errorf("Error executing statement on device %v: %v", recordsToStore[0].DeviceID, err.Error())
-	}
 
-	err = stmt.Close()
+		// composites of cross-listed classes can be longer than the columns
+		recordToStore.TeachingArea = truncate(recordToStore.TeachingArea, 50)
+		recordToStore.CourseNumber = truncate(recordToStore.CourseNumber, 50)
+		recordToStore.SectionNumber = truncate(recordToStore.SectionNumber, 50)
+		recordToStore.ScheduleType = truncate(recordToStore.ScheduleType, 50)
+		recordToStore.ClassName = truncate(recordToStore.ClassName, 100)
+		recordToStore.Shift = truncate(recordToStore.Shift, 50)
 
-	if err != nil {
-		log.L.Errorf("Error closing statement on device %v: %v", recordsToStore[0].DeviceID, err.Error())
+		rows = append(rows, recordToStore.values())
 	}
 
-	err = txn.Commit()
-
+	x, err := c.db.BulkInsert(txn, c.config.Table, metricsColumns, rows)
 	if err != nil {
-		log.L.Debugf("Error committing txn on device %v: %v", recordsToStore[0].DeviceID, err.Error())
+		return 0, fmt.Errorf("unable to insert records: %w", err)
 	}
 
-	x, err := result.RowsAffected()
-
 	log.L.Debugf("%v record stored in %v", x, recordsToStore[0].DeviceID)
+	return x, nil
+}
 
-	if err != nil {
-		log.L.Errorf("Error getting record count on device %v: %v", recordsToStore[0].DeviceID, err.Error())
+// metricsColumns are the columns of the metrics table, in the order of MetricsRecord.values.
+var metricsColumns = []string{
+	"DeviceID",
+	"RoomID",
+	"BuildingID",
+	"DeviceIDPrefix",
+	"StartTime",
+	"EndTime",
+	"ExceptionDateType",
+	"Shift",
+	"StartHour",
+	"StartDayOfWeek",
+	"StartDay",
+	"StartMonth",
+	"StartYear",
+	"ElapsedSeconds",
+	"IsClass",
+	"TeachingArea",
+	"CourseNumber",
+	"SectionNumber",
+	"ClassName",
+	"ScheduleType",
+	"InstructorName",
+	"Power",
+	"Blanked",
+	"InputType",
+	"Input",
+	"InputActiveSignal",
+	"StatusDesc",
+}
+
+func (r MetricsRecord) values() []interface{} {
+	return []interface{}{
+		r.DeviceID,
+		r.RoomID,
+		r.BuildingID,
+		r.DeviceIDPrefix,
+		r.StartTime,
+		r.EndTime,
+		r.ExceptionDateType,
+		r.Shift,
+		r.StartHour,
+		r.StartDayOfWeek,
+		r.StartDay,
+		r.StartMonth,
+		r.StartYear,
+		r.ElapsedSeconds,
+		r.IsClass,
+		r.TeachingArea,
+		r.CourseNumber,
+		r.SectionNumber,
+		r.ClassName,
+		r.ScheduleType,
+		r.InstructorName,
+		r.Power,
+		r.Blanked,
+		r.InputType,
+		r.Input,
+		r.InputActiveSignal,
+		r.StatusDesc,
 	}
 }
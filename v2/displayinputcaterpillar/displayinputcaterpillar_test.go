@@ -1,12 +1,120 @@
 package displayinputcaterpillar
 
 import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/caterpillar/v2/schedule"
 	"github.com/byuoitav/common/log"
+	"github.com/byuoitav/common/v2/events"
 )
 
 func Test(t *testing.T) {
 	log.SetLevel("debug")
-	StartDisplayInputCaterpillar("HCEB")
+	if err := StartDisplayInputCaterpillar("HCEB"); err != nil {
+		t.Fatalf("Error %v", err.Error())
+	}
+}
+
+// newTestCaterpillar is a caterpillar on a migrated in memory sqlite db, with ITB-1101-D1 in its inventory and no classes.
+func newTestCaterpillar(t *testing.T) *Caterpillar {
+	inv := filepath.Join(t.TempDir(), "inventory.json")
+	if err := ioutil.WriteFile(inv, []byte(`{"devices": [{"id": "ITB-1101-D1"}], "rooms": [{"id": "ITB-1101"}]}`), 0644); err != nil {
+		t.Fatalf("unable to write inventory: %v", err)
+	}
+
+	db, err := metricssql.Open(metricssql.Config{Driver: metricssql.SQLite, ConnectionString: ":memory:"})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+
+	return &Caterpillar{
+		config:    Config{Table: "DisplayInputMetrics", Workers: 1, Inventory: inv},
+		db:        db,
+		schedules: schedule.NewStatic(nil),
+		slicer:    schedule.Slicer{Every: time.Hour},
+	}
+}
+
+func TestCarryToWindowEnd(t *testing.T) {
+	c := newTestCaterpillar(t)
+
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, byuLocation)
+	end := start.Add(150 * time.Minute)
+	device := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	evs := []events.Event{
+		{Key: "power", Value: "on", Timestamp: start.Add(10 * time.Minute), TargetDevice: device},
+		{Key: "input", Value: "hdmi1", Timestamp: start.Add(30 * time.Minute), TargetDevice: device},
+	}
+
+	summary := c.ProcessDevices(map[string][]events.Event{device.DeviceID: evs}, end)
+	if err := summary.Err(); err != nil {
+		t.Fatalf("unable to process device: %v", err)
+	}
+
+	// the state is carried to the last whole hour of the backfill, not up to now
+	_, state, err := c.getLastKnownState(device.DeviceID)
+	if err != nil {
+		t.Fatalf("unable to get last known state: %v", err)
+	}
+	if !state.StartTime.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("expected the last known state at %v, got %v", start.Add(2*time.Hour), state.StartTime)
+	}
+
+	var ends []time.Time
+	if err := c.db.Select(&ends, `SELECT "EndTime" FROM "DisplayInputMetrics"`); err != nil {
+		t.Fatalf("unable to get records: %v", err)
+	}
+	if len(ends) == 0 {
+		t.Fatalf("expected records to be stored")
+	}
+	for _, e := range ends {
+		if e.After(end) {
+			t.Errorf("expected no records past %v, got one ending at %v", end, e)
+		}
+	}
+}
+
+type brokenSchedule struct{}
+
+func (brokenSchedule) ClassesForDay(room string, day time.Time) ([]schedule.Class, error) {
+	return nil, errors.New("schedule unavailable")
+}
+
+func TestScheduleErrorFailsDevice(t *testing.T) {
+	c := newTestCaterpillar(t)
+	c.schedules = brokenSchedule{}
+
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, byuLocation)
+	device := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	evs := []events.Event{
+		{Key: "power", Value: "on", Timestamp: start, TargetDevice: device},
+		{Key: "input", Value: "hdmi1", Timestamp: start.Add(30 * time.Minute), TargetDevice: device},
+	}
+
+	summary := c.ProcessDevices(map[string][]events.Event{device.DeviceID: evs}, start.Add(2*time.Hour))
+	if _, ok := summary.FailedDevices[device.DeviceID]; !ok {
+		t.Fatalf("expected %v to fail without a class schedule, got %v", device.DeviceID, summary)
+	}
+
+	var n int
+	if err := c.db.Get(&n, `SELECT COUNT(*) FROM "DisplayInputMetrics"`); err != nil {
+		t.Fatalf("unable to count records: %v", err)
+	}
+	lks, _, err := c.getLastKnownState(device.DeviceID)
+	if err != nil {
+		t.Fatalf("unable to get last known state: %v", err)
+	}
+	if n != 0 || lks.LastKnownStateID != 0 {
+		t.Errorf("expected nothing to be stored for a failed device, got %v records", n)
+	}
 }
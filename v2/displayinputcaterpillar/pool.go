@@ -0,0 +1,98 @@
+package displayinputcaterpillar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/byuoitav/common/log"
+)
+
+const defaultWorkers = 10
+
+// Summary is the result of a run over a set of devices.
+type Summary struct {
+	Devices        int
+	Processed      int
+	Failed         int
+	RecordsWritten int
+
+	FailedDevices map[string]string // device -> error
+}
+
+// Add adds another summary's counts to s.
+func (s *Summary) Add(other Summary) {
+	s.Devices += other.Devices
+	s.Processed += other.Processed
+	s.Failed += other.Failed
+	s.RecordsWritten += other.RecordsWritten
+
+	for k, v := range other.FailedDevices {
+		if s.FailedDevices == nil {
+			s.FailedDevices = map[string]string{}
+		}
+		s.FailedDevices[k] = v
+	}
+}
+
+// Err returns an error listing the failed devices, or nil if none failed.
+func (s Summary) Err() error {
+	if s.Failed == 0 {
+		return nil
+	}
+
+	failed := []string{}
+	for k, v := range s.FailedDevices {
+		failed = append(failed, fmt.Sprintf("%s: %s", k, v))
+	}
+
+	return fmt.Errorf("%d of %d devices failed: %s", s.Failed, s.Devices, strings.Join(failed, "; "))
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d devices, %d processed, %d failed, %d records written", s.Devices, s.Processed, s.Failed, s.RecordsWritten)
+}
+
+// runPool runs fn for each device, config.Workers at a time. An error on one device doesn't affect the others.
+func (c *Caterpillar) runPool(devices []string, fn func(string) (int, error)) Summary {
+	summary := Summary{
+		Devices:       len(devices),
+		FailedDevices: map[string]string{},
+	}
+	var mu sync.Mutex
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for device := range work {
+				log.L.Debugf("Processing device %v", device)
+				written, err := fn(device)
+
+				mu.Lock()
+				if err != nil {
+					// the device's transaction is rolled back, so nothing it wrote was kept.
+					log.L.Errorf("Unable to process device %v: %v", device, err.Error())
+					summary.Failed++
+					summary.FailedDevices[device] = err.Error()
+				} else {
+					summary.Processed++
+					summary.RecordsWritten += written
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, d := range devices {
+		work <- d
+	}
+	close(work)
+	wg.Wait()
+
+	return summary
+}
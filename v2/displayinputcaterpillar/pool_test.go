@@ -0,0 +1,49 @@
+package displayinputcaterpillar
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunPool(t *testing.T) {
+	c := &Caterpillar{config: Config{Workers: 3}}
+
+	devices := []string{}
+	for i := 0; i < 20; i++ {
+		devices = append(devices, fmt.Sprintf("ITB-1101-D%d", i))
+	}
+
+	var running, most int32
+	summary := c.runPool(devices, func(id string) (int, error) {
+		cur := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if cur <= m || atomic.CompareAndSwapInt32(&most, m, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		if id == "ITB-1101-D7" {
+			return 2, errors.New("no connection")
+		}
+		return 5, nil
+	})
+
+	if most > 3 {
+		t.Errorf("expected at most 3 devices at once, had %d", most)
+	}
+	if summary.Devices != 20 || summary.Processed != 19 || summary.Failed != 1 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+	if summary.RecordsWritten != 19*5 {
+		t.Errorf("expected %d records written, got %d", 19*5, summary.RecordsWritten)
+	}
+	if _, ok := summary.FailedDevices["ITB-1101-D7"]; !ok || summary.Err() == nil {
+		t.Errorf("expected ITB-1101-D7 to be reported as failed")
+	}
+}
@@ -0,0 +1,120 @@
+package displayinputcaterpillar
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/caterpillar/v2/metricssql"
+	"github.com/byuoitav/common/v2/events"
+)
+
+// TestMetricsColumns makes sure the migrations have a column for everything in a MetricsRecord.
+func TestMetricsColumns(t *testing.T) {
+	db, err := metricssql.Open(metricssql.Config{Driver: metricssql.SQLite, ConnectionString: ":memory:"})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, time.UTC)
+	rec := MetricsRecord{
+		DeviceID:       "ITB-1101-D1",
+		RoomID:         "ITB-1101",
+		BuildingID:     "ITB",
+		DeviceIDPrefix: "D",
+		StartTime:      start,
+		EndTime:        start.Add(time.Hour),
+		ElapsedSeconds: 3600,
+		Power:          "on",
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unable to start txn: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := db.BulkInsert(tx, "DisplayInputMetrics", metricsColumns, [][]interface{}{rec.values()}); err != nil {
+		t.Fatalf("unable to insert a metrics record: %v", err)
+	}
+}
+
+// TestStoreRollback makes sure a device is left as it was when storing its records or its last known state fails.
+func TestStoreRollback(t *testing.T) {
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, byuLocation)
+	device := events.BasicDeviceInfo{DeviceID: "ITB-1101-D1", BasicRoomInfo: events.BasicRoomInfo{RoomID: "ITB-1101", BuildingID: "ITB"}}
+	first := []events.Event{
+		{Key: "power", Value: "on", Timestamp: start, TargetDevice: device},
+		{Key: "input", Value: "hdmi1", Timestamp: start.Add(30 * time.Minute), TargetDevice: device},
+	}
+	second := append(first, events.Event{Key: "power", Value: "standby", Timestamp: start.Add(3 * time.Hour), TargetDevice: device})
+
+	triggers := map[string]string{
+		"insert": `CREATE TRIGGER "FailInsert" BEFORE INSERT ON "DisplayInputMetrics" BEGIN SELECT RAISE(ABORT, 'insert failed'); END`,
+		"upsert": `CREATE TRIGGER "FailUpsert" BEFORE UPDATE ON "LastKnownStates" BEGIN SELECT RAISE(ABORT, 'upsert failed'); END`,
+	}
+
+	for name, trigger := range triggers {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCaterpillar(t)
+
+			if summary := c.ProcessDevices(map[string][]events.Event{device.DeviceID: first}, start.Add(time.Hour)); summary.Err() != nil {
+				t.Fatalf("unable to process device: %v", summary.Err())
+			}
+
+			lks, _, err := c.getLastKnownState(device.DeviceID)
+			if err != nil {
+				t.Fatalf("unable to get last known state: %v", err)
+			}
+
+			// a record from after the last known state, which is deleted before the device is redone
+			stray := MetricsRecord{DeviceID: device.DeviceID, RoomID: "ITB-1101", BuildingID: "ITB", DeviceIDPrefix: "D", StartTime: lks.LastKnownStateTime, EndTime: lks.LastKnownStateTime.Add(time.Hour)}
+			tx, err := c.db.Begin()
+			if err != nil {
+				t.Fatalf("unable to start txn: %v", err)
+			}
+			if _, err := c.db.BulkInsert(tx, "DisplayInputMetrics", metricsColumns, [][]interface{}{stray.values()}); err != nil {
+				tx.Rollback()
+				t.Fatalf("unable to insert a metrics record: %v", err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("unable to commit: %v", err)
+			}
+
+			var rows []MetricsRecord
+			if err := c.db.Select(&rows, `SELECT * FROM "DisplayInputMetrics" ORDER BY "StartTime"`); err != nil {
+				t.Fatalf("unable to get records: %v", err)
+			}
+
+			if _, err := c.db.Exec(trigger); err != nil {
+				t.Fatalf("unable to create trigger: %v", err)
+			}
+
+			summary := c.ProcessDevices(map[string][]events.Event{device.DeviceID: second}, start.Add(4*time.Hour))
+			if _, ok := summary.FailedDevices[device.DeviceID]; !ok {
+				t.Fatalf("expected %v to fail, got %v", device.DeviceID, summary)
+			}
+
+			after, _, err := c.getLastKnownState(device.DeviceID)
+			if err != nil {
+				t.Fatalf("unable to get last known state: %v", err)
+			}
+			if after.LastKnownStateJSON != lks.LastKnownStateJSON || !after.LastKnownStateTime.Equal(lks.LastKnownStateTime) {
+				t.Errorf("expected the last known state to be left at %v, got %v", lks.LastKnownStateTime, after.LastKnownStateTime)
+			}
+
+			var afterRows []MetricsRecord
+			if err := c.db.Select(&afterRows, `SELECT * FROM "DisplayInputMetrics" ORDER BY "StartTime"`); err != nil {
+				t.Fatalf("unable to get records: %v", err)
+			}
+			if !reflect.DeepEqual(rows, afterRows) {
+				t.Errorf("expected the records to be left as they were, had %v now %v", len(rows), len(afterRows))
+			}
+		})
+	}
+}
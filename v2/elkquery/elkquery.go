@@ -82,6 +82,13 @@ type QueryResponse struct {
 		} `json:"hits"`
 	} `json:"hits"`
 	Aggregations interface{} `json:"aggregations"`
+	ScrollID     string      `json:"_scroll_id,omitempty"`
+}
+
+// scrollRequest is the body used to get the next page of a scroll, or to clear it.
+type scrollRequest struct {
+	Scroll   string `json:"scroll,omitempty"`
+	ScrollID string `json:"scroll_id"`
 }
 
 // GetQueryTemplateFromFile .
@@ -135,10 +142,69 @@ func ExecuteElkQuery(indexName string, q QueryTemplate) (QueryResponse, *nerr.E)
 	return toReturn, nil
 }
 
+// ScrollElkQuery runs the query with the scroll api, calling fn with each page of hits in order until there are no more hits or fn returns an error.
+// The query's size is the page size, and keepAlive is how long ELK should hold the scroll between pages, e.g. "1m".
+func ScrollElkQuery(indexName string, q QueryTemplate, keepAlive string, fn func(QueryResponse) error) *nerr.E {
+	b, er := json.Marshal(q)
+	if er != nil {
+		return nerr.Translate(er).Addf("Couldn't scroll query.")
+	}
+
+	resp, err := searchRequest(fmt.Sprintf("/%v/_search?scroll=%v", indexName, keepAlive), b)
+	if err != nil {
+		return err.Addf("Couldn't start scroll on index %v", indexName)
+	}
+
+	scrollID := resp.ScrollID
+	defer func() {
+		if len(scrollID) == 0 {
+			return
+		}
+
+		if _, err := MakeELKRequest("DELETE", "/_search/scroll", scrollRequest{ScrollID: scrollID}); err != nil {
+			log.L.Warnf("Couldn't clear scroll: %v", err.Error())
+		}
+	}()
+
+	for page := 0; len(resp.Hits.Hits) > 0; page++ {
+		log.L.Debugf("Got page %v of scroll on %v with %v hits", page, indexName, len(resp.Hits.Hits))
+
+		if er := fn(resp); er != nil {
+			return nerr.Translate(er).Addf("Couldn't handle page %v of scroll on %v", page, indexName)
+		}
+
+		resp, err = searchRequest("/_search/scroll", scrollRequest{Scroll: keepAlive, ScrollID: scrollID})
+		if err != nil {
+			return err.Addf("Couldn't get page %v of scroll on %v", page+1, indexName)
+		}
+
+		if len(resp.ScrollID) > 0 {
+			scrollID = resp.ScrollID
+		}
+	}
+
+	return nil
+}
+
+func searchRequest(endpoint string, body interface{}) (QueryResponse, *nerr.E) {
+	var toReturn QueryResponse
+
+	resp, err := MakeELKRequest("POST", endpoint, body)
+	if err != nil {
+		return toReturn, err
+	}
+
+	if er := json.Unmarshal(resp, &toReturn); er != nil {
+		return toReturn, nerr.Translate(er).Addf("Couldn't unmarshal search response.")
+	}
+
+	return toReturn, nil
+}
+
 // MakeELKRequest .
 func MakeELKRequest(method, endpoint string, body interface{}) ([]byte, *nerr.E) {
 	if len(APIAddr) == 0 {
-		log.L.Fatalf("ELK_DIRECT_ADDRESS is not set.")
+		return []byte{}, nerr.Create("ELK_DIRECT_ADDRESS is not set.", "invalid-config")
 	}
 
 	// format whole address
@@ -150,7 +216,7 @@ func MakeELKRequest(method, endpoint string, body interface{}) ([]byte, *nerr.E)
 	if len(user) == 0 || len(pass) == 0 {
 		if len(user) == 0 || len(pass) == 0 {
 			log.L.Debugf("ELK username and password are not set")
-			log.L.Fatalf("ELK_SA_USERNAME, or ELK_SA_PASSWORD is not set.")
+			return []byte{}, nerr.Create("ELK_SA_USERNAME, or ELK_SA_PASSWORD is not set.", "invalid-config")
 		}
 	}
 	var reqBody []byte
@@ -0,0 +1,81 @@
+package elkquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/byuoitav/common/v2/events"
+)
+
+func TestScrollElkQuery(t *testing.T) {
+	// 25 events, served 10 at a time
+	pages := [][]events.Event{}
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		if i%10 == 0 {
+			pages = append(pages, []events.Event{})
+		}
+		pages[len(pages)-1] = append(pages[len(pages)-1], events.Event{Key: "power", Value: "on", Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	cleared := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 0
+		switch {
+		case r.Method == http.MethodDelete:
+			cleared = true
+			return
+		case strings.HasPrefix(r.URL.Path, "/_search/scroll"):
+			var req scrollRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			fmt.Sscanf(req.ScrollID, "page-%d", &page)
+		case r.URL.Query().Get("scroll") != "1m":
+			t.Errorf("expected a scroll to be started, got %v", r.URL)
+		}
+
+		resp := QueryResponse{ScrollID: fmt.Sprintf("page-%d", page+1)}
+		resp.Hits.Total = 25
+		if page < len(pages) {
+			for _, e := range pages[page] {
+				resp.Hits.Hits = append(resp.Hits.Hits, struct {
+					Index  string       `json:"_index"`
+					Type   string       `json:"_type"`
+					ID     string       `json:"_id"`
+					Source events.Event `json:"_source"`
+				}{Source: e})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	APIAddr, username, password = server.URL, "user", "pass"
+
+	got := []events.Event{}
+	err := ScrollElkQuery("av-delta-events*", QueryTemplate{Size: 10}, "1m", func(resp QueryResponse) error {
+		for _, hit := range resp.Hits.Hits {
+			got = append(got, hit.Source)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err.Error())
+	}
+
+	if len(got) != 25 {
+		t.Fatalf("expected 25 events, got %v", len(got))
+	}
+	for i := range got {
+		if !got[i].Timestamp.Equal(start.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("event %v out of order: %v", i, got[i].Timestamp)
+		}
+	}
+	if !cleared {
+		t.Errorf("expected the scroll to be cleared")
+	}
+}
@@ -9,6 +9,8 @@ require (
 	github.com/byuoitav/wso2services v0.0.0-20200403171154-5fd99bc6b056
 	github.com/denisenkom/go-mssqldb v0.11.0
 	github.com/jmoiron/sqlx v1.3.4
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
 )
 
 require (
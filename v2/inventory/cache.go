@@ -0,0 +1,82 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+)
+
+// RefreshInterval is how long the inventories from Get are used before they're loaded again.
+var RefreshInterval = 5 * time.Minute
+
+// Cache keeps the inventory from a provider, loading it again once it's older than Interval.
+// If loading it again fails the old inventory is kept; an error is only returned if it has never been loaded.
+type Cache struct {
+	Provider Provider
+	Interval time.Duration
+
+	mu        sync.Mutex
+	inventory *Inventory
+}
+
+// NewCache wraps p in a cache.
+func NewCache(p Provider, interval time.Duration) *Cache {
+	return &Cache{
+		Provider: p,
+		Interval: interval,
+	}
+}
+
+// Load fulfills the Provider interface.
+func (c *Cache) Load() (*Inventory, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.inventory != nil && time.Since(c.inventory.Loaded) < c.Interval {
+		return c.inventory, nil
+	}
+
+	inv, err := c.Provider.Load()
+	if err != nil {
+		if c.inventory != nil {
+			log.L.Warnf("Unable to reload inventory, using the one from %v: %v", c.inventory.Loaded.Format(time.RFC3339), err)
+			return c.inventory, nil
+		}
+		return nil, err
+	}
+
+	log.L.Infof("Loaded inventory with %v devices and %v rooms", len(inv.Devices), len(inv.Rooms))
+	c.inventory = inv
+	return inv, nil
+}
+
+var (
+	caches   = map[string]*Cache{}
+	cachesMu sync.Mutex
+)
+
+// Get gets the inventory for a source (see ProviderFor). Each source has one cache shared by every caterpillar that uses it, so it's loaded at most once every RefreshInterval.
+func Get(source string) (*Inventory, error) {
+	source = strings.TrimSpace(source)
+	if len(source) == 0 {
+		source = "couch"
+	}
+
+	cachesMu.Lock()
+	c, ok := caches[source]
+	if !ok {
+		c = NewCache(ProviderFor(source), RefreshInterval)
+		caches[source] = c
+	}
+	cachesMu.Unlock()
+
+	inv, err := c.Load()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load inventory %s: %w", source, err)
+	}
+
+	return inv, nil
+}
@@ -0,0 +1,97 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Device is a device in a room.
+type Device struct {
+	ID    string   `json:"id"`
+	Type  string   `json:"type,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+
+	Room string `json:"room,omitempty"` // if empty, it comes from the device's id, see RoomID.
+}
+
+// Room is a room with devices in it.
+type Room struct {
+	ID              string   `json:"id"`
+	DeploymentGroup string   `json:"deployment-group,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+}
+
+// Provider loads every device and room.
+type Provider interface {
+	Load() (*Inventory, error)
+}
+
+// Inventory is every device and room we know about, keyed by id. It isn't changed once it's loaded, so it's safe to share.
+type Inventory struct {
+	Devices map[string]Device
+	Rooms   map[string]Room
+	Loaded  time.Time
+}
+
+// New builds an inventory from lists of devices and rooms.
+func New(devices []Device, rooms []Room) *Inventory {
+	toReturn := &Inventory{
+		Devices: make(map[string]Device, len(devices)),
+		Rooms:   make(map[string]Room, len(rooms)),
+		Loaded:  time.Now(),
+	}
+
+	for _, d := range devices {
+		toReturn.Devices[d.ID] = d
+	}
+	for _, r := range rooms {
+		toReturn.Rooms[r.ID] = r
+	}
+
+	return toReturn
+}
+
+// Device gets a device by id.
+func (i *Inventory) Device(id string) (Device, bool) {
+	if i == nil {
+		return Device{}, false
+	}
+	d, ok := i.Devices[id]
+	return d, ok
+}
+
+// Room gets a room by id.
+func (i *Inventory) Room(id string) (Room, bool) {
+	if i == nil {
+		return Room{}, false
+	}
+	r, ok := i.Rooms[id]
+	return r, ok
+}
+
+// RoomID gets the id of the room the device is in.
+func (d Device) RoomID() string {
+	if len(d.Room) > 0 {
+		return d.Room
+	}
+
+	room, _, _ := SplitID(d.ID)
+	return room
+}
+
+// BuildingID gets the id of the building the device is in.
+func (d Device) BuildingID() string {
+	return strings.SplitN(d.RoomID(), "-", 2)[0]
+}
+
+// SplitID splits a device id, e.g. ITB-1101-D1, into its room (ITB-1101) and building (ITB).
+func SplitID(id string) (room, building string, err error) {
+	parts := strings.Split(id, "-")
+	if len(parts) < 3 {
+		return "", "", fmt.Errorf("invalid device id %s", id)
+	}
+
+	return parts[0] + "-" + parts[1], parts[0], nil
+}
@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInventory = `{
+	"devices": [
+		{"id": "ITB-1101-D1", "type": "SonyXBR", "roles": ["VideoOut"], "tags": ["projector"]},
+		{"id": "HBLL-1010-CP1", "type": "Pi3", "roles": ["ControlProcessor"], "room": "HBLL-1010A"}
+	],
+	"rooms": [
+		{"id": "ITB-1101", "deployment-group": "production", "tags": ["classroom"]}
+	]
+}`
+
+func TestDecode(t *testing.T) {
+	inv, err := Decode(strings.NewReader(testInventory))
+	if err != nil {
+		t.Fatalf("unable to decode: %v", err)
+	}
+
+	d, ok := inv.Device("ITB-1101-D1")
+	if !ok || d.Type != "SonyXBR" || len(d.Roles) != 1 || d.Roles[0] != "VideoOut" {
+		t.Fatalf("unexpected device: %+v", d)
+	}
+	if d.RoomID() != "ITB-1101" || d.BuildingID() != "ITB" {
+		t.Errorf("got room %v building %v for %v", d.RoomID(), d.BuildingID(), d.ID)
+	}
+
+	d, _ = inv.Device("HBLL-1010-CP1")
+	if d.RoomID() != "HBLL-1010A" || d.BuildingID() != "HBLL" {
+		t.Errorf("got room %v building %v for %v", d.RoomID(), d.BuildingID(), d.ID)
+	}
+
+	r, ok := inv.Room("ITB-1101")
+	if !ok || r.DeploymentGroup != "production" {
+		t.Errorf("unexpected room: %+v", r)
+	}
+
+	var nilInventory *Inventory
+	if _, ok := nilInventory.Device("ITB-1101-D1"); ok {
+		t.Errorf("found a device in a nil inventory")
+	}
+}
+
+type countingProvider struct {
+	loads int
+	err   error
+}
+
+func (p *countingProvider) Load() (*Inventory, error) {
+	p.loads++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return New([]Device{{ID: "ITB-1101-D1"}}, nil), nil
+}
+
+func TestCache(t *testing.T) {
+	p := &countingProvider{}
+	c := NewCache(p, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Load(); err != nil {
+			t.Fatalf("unable to load: %v", err)
+		}
+	}
+	if p.loads != 1 {
+		t.Errorf("loaded %v times, expected 1", p.loads)
+	}
+
+	// a failed refresh keeps the old inventory
+	c.Interval = 0
+	p.err = errors.New("couch is down")
+
+	inv, err := c.Load()
+	if err != nil || len(inv.Devices) != 1 {
+		t.Errorf("expected the stale inventory, got %v, %v", inv, err)
+	}
+	if p.loads != 2 {
+		t.Errorf("loaded %v times, expected 2", p.loads)
+	}
+
+	if _, err := NewCache(p, time.Hour).Load(); err == nil {
+		t.Errorf("expected an error from a cache that has never loaded")
+	}
+}
@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/db"
+)
+
+// Couch loads devices and rooms from the couch database (see db.GetDB).
+type Couch struct{}
+
+// Load fulfills the Provider interface.
+func (Couch) Load() (*Inventory, error) {
+	devs, err := db.GetDB().GetAllDevices()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get devices: %w", err)
+	}
+
+	rooms, err := db.GetDB().GetAllRooms()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get rooms: %w", err)
+	}
+
+	devices := make([]Device, 0, len(devs))
+	for _, d := range devs {
+		dev := Device{
+			ID:   d.ID,
+			Type: d.Type.ID,
+			Tags: d.Tags,
+		}
+
+		for _, role := range d.Roles {
+			dev.Roles = append(dev.Roles, role.ID)
+		}
+
+		devices = append(devices, dev)
+	}
+
+	toReturn := make([]Room, 0, len(rooms))
+	for _, r := range rooms {
+		toReturn = append(toReturn, Room{
+			ID:              r.ID,
+			DeploymentGroup: r.Designation,
+			Tags:            r.Tags,
+		})
+	}
+
+	return New(devices, toReturn), nil
+}
+
+// file is the format of the static json file and of the response from an inventory url.
+type file struct {
+	Devices []Device `json:"devices"`
+	Rooms   []Room   `json:"rooms"`
+}
+
+// Decode reads an inventory in the form {"devices": [...], "rooms": [...]}.
+func Decode(r io.Reader) (*Inventory, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("unable to decode inventory: %w", err)
+	}
+
+	return New(f.Devices, f.Rooms), nil
+}
+
+// File loads devices and rooms from a static json file (see Decode).
+type File struct {
+	Path string
+}
+
+// Load fulfills the Provider interface.
+func (f File) Load() (*Inventory, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open inventory: %w", err)
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// HTTP loads devices and rooms from a url that returns the same json as a static file (see Decode).
+type HTTP struct {
+	URL string
+}
+
+// Load fulfills the Provider interface.
+func (h HTTP) Load() (*Inventory, error) {
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := client.Get(h.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get inventory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unable to get inventory: %s", resp.Status)
+	}
+
+	return Decode(resp.Body)
+}
+
+// ProviderFor gets the provider for an inventory source: "couch" (or empty) for the couch database, an http(s) url, or the path of a json file.
+func ProviderFor(source string) Provider {
+	source = strings.TrimSpace(source)
+
+	switch {
+	case len(source) == 0 || source == "couch":
+		return Couch{}
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return HTTP{URL: source}
+	}
+
+	return File{Path: source}
+}
@@ -0,0 +1,106 @@
+package metricssql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/byuoitav/common/log"
+	"github.com/jmoiron/sqlx"
+)
+
+// The databases metrics can be stored in. Each is also the name of the database/sql driver used for it.
+const (
+	SQLServer = "sqlserver"
+	Postgres  = "postgres"
+	SQLite    = "sqlite3"
+)
+
+// ErrNoConnectionString is returned when there isn't a connection string in the config and METRICS_SQL_CONNECTION_STRING isn't set.
+var ErrNoConnectionString = errors.New("need SQL connection string, METRICS_SQL_CONNECTION_STRING is not set")
+
+// Config is how to connect to the metrics database.
+type Config struct {
+	Driver           string // sqlserver, postgres, or sqlite3. defaults to METRICS_SQL_DRIVER, then sqlserver.
+	ConnectionString string // defaults to METRICS_SQL_CONNECTION_STRING.
+	Schema           string // schema the tables are in. defaults to dbo on sql server and public on postgres. sqlite doesn't have schemas.
+}
+
+// Dialect is the part of talking to the metrics database that's different for each database.
+// Queries run against the database should use ? placeholders and go through Rebind.
+type Dialect interface {
+	// Quote quotes an identifier, e.g. a column name.
+	Quote(name string) string
+
+	// Table gets the quoted name of a table in the configured schema.
+	Table(name string) string
+
+	// BulkInsert inserts rows into the table in tx, using the fastest way the database has. Returns the number of rows inserted.
+	BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) (int, error)
+
+	// UpsertLastKnownState sets a device's last known state in tx.
+	UpsertLastKnownState(tx *sql.Tx, deviceID string, stateTime time.Time, state string) error
+}
+
+// DB is a connection to the metrics database.
+type DB struct {
+	*sqlx.DB
+	Dialect
+
+	Config Config
+}
+
+// Open connects to the metrics database described by config.
+func Open(config Config) (*DB, error) {
+	if len(config.Driver) == 0 {
+		config.Driver = os.Getenv("METRICS_SQL_DRIVER")
+	}
+	if len(config.Driver) == 0 {
+		config.Driver = SQLServer
+	}
+	if len(config.ConnectionString) == 0 {
+		config.ConnectionString = os.Getenv("METRICS_SQL_CONNECTION_STRING")
+	}
+	if len(config.ConnectionString) == 0 {
+		return nil, ErrNoConnectionString
+	}
+
+	var dialect Dialect
+	switch config.Driver {
+	case SQLServer:
+		if len(config.Schema) == 0 {
+			config.Schema = "dbo"
+		}
+		dialect = sqlServer{schema: config.Schema}
+	case Postgres:
+		if len(config.Schema) == 0 {
+			config.Schema = "public"
+		}
+		dialect = postgres{schema: config.Schema}
+	case SQLite:
+		config.Schema = ""
+		dialect = sqlite{}
+	default:
+		return nil, fmt.Errorf("unknown sql driver %q, must be one of %s, %s, or %s", config.Driver, SQLServer, Postgres, SQLite)
+	}
+
+	db, err := sqlx.Connect(config.Driver, config.ConnectionString)
+	if err != nil {
+		log.L.Debugf("Error connecting to SQL %v", err.Error())
+		return nil, fmt.Errorf("unable to connect to %s: %w", config.Driver, err)
+	}
+
+	if config.Driver == SQLite {
+		// sqlite only allows one writer at a time
+		db.SetMaxOpenConns(1)
+	}
+
+	log.L.Debugf("Connected to %v DB", config.Driver)
+	return &DB{
+		DB:      db,
+		Dialect: dialect,
+		Config:  config,
+	}, nil
+}
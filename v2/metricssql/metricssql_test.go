@@ -0,0 +1,51 @@
+package metricssql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSQLite(t *testing.T) {
+	db, err := Open(Config{Driver: SQLite, ConnectionString: ":memory:"})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+
+	db.MustExec(`CREATE TABLE "LastKnownStates" ("LastKnownStateID" INTEGER PRIMARY KEY, "DeviceID" TEXT UNIQUE, "LastKnownStateTime" DATETIME, "LastKnownStateJSON" TEXT)`)
+	db.MustExec(`CREATE TABLE "Metrics" ("DeviceID" TEXT, "ElapsedSeconds" INTEGER)`)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unable to start txn: %v", err)
+	}
+
+	n, err := db.BulkInsert(tx, "Metrics", []string{"DeviceID", "ElapsedSeconds"}, [][]interface{}{{"ITB-1101-D1", 60}, {"ITB-1101-D1", 120}})
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 rows inserted, got %v: %v", n, err)
+	}
+
+	start := time.Date(2019, 9, 3, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := db.UpsertLastKnownState(tx, "ITB-1101-D1", start.Add(time.Duration(i)*time.Hour), "{}"); err != nil {
+			t.Fatalf("unable to upsert last known state: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+
+	var total int
+	if err := db.Get(&total, db.Rebind(`SELECT SUM("ElapsedSeconds") FROM `+db.Table("Metrics")+` WHERE "DeviceID" = ?`), "ITB-1101-D1"); err != nil || total != 180 {
+		t.Errorf("expected 180 seconds stored, got %v: %v", total, err)
+	}
+
+	var states []time.Time
+	if err := db.Select(&states, `SELECT "LastKnownStateTime" FROM "LastKnownStates"`); err != nil {
+		t.Fatalf("unable to get last known states: %v", err)
+	}
+	if len(states) != 1 || !states[0].Equal(start.Add(time.Hour)) {
+		t.Errorf("expected a single last known state at %v, got %v", start.Add(time.Hour), states)
+	}
+}
@@ -0,0 +1,163 @@
+package metricssql
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/byuoitav/common/log"
+)
+
+// migrations has a directory of migrations for each driver. Each file is named <version>_<description>.sql, and is applied in a single transaction.
+// $SCHEMA is replaced with the configured schema, and a line with only GO on it splits the file into batches that are run separately (for sql server).
+//
+//go:embed migrations
+var migrations embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+var batchSeparator = regexp.MustCompile(`(?im)^\s*GO\s*$`)
+
+// schemaVersionTable creates the table that tracks which migrations have been applied, if it doesn't exist.
+var schemaVersionTable = map[string][]string{
+	SQLServer: {
+		`IF SCHEMA_ID(N'$SCHEMA') IS NULL EXEC('CREATE SCHEMA [$SCHEMA]')`,
+		`IF OBJECT_ID(N'[$SCHEMA].[SchemaVersion]', N'U') IS NULL
+		CREATE TABLE [$SCHEMA].[SchemaVersion] ([Version] INT PRIMARY KEY, [Description] NVARCHAR(250) NOT NULL, [AppliedAt] DATETIMEOFFSET NOT NULL)`,
+	},
+	Postgres: {
+		`CREATE SCHEMA IF NOT EXISTS "$SCHEMA"`,
+		`CREATE TABLE IF NOT EXISTS "$SCHEMA"."SchemaVersion" ("Version" INTEGER PRIMARY KEY, "Description" TEXT NOT NULL, "AppliedAt" TIMESTAMPTZ NOT NULL)`,
+	},
+	SQLite: {
+		`CREATE TABLE IF NOT EXISTS "SchemaVersion" ("Version" INTEGER PRIMARY KEY, "Description" TEXT NOT NULL, "AppliedAt" DATETIME NOT NULL)`,
+	},
+}
+
+// Migration is a versioned change to the metrics schema.
+type Migration struct {
+	Version     int
+	Description string
+	Batches     []string
+}
+
+// Migrations gets the migrations for the driver, in order, with $SCHEMA replaced by schema.
+func Migrations(driver, schema string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := migrations.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %s: %w", driver, err)
+	}
+
+	toReturn := []Migration{}
+	seen := map[int]string{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("invalid migration name %s, must be <version>_<description>.sql", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		if prev, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", prev, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		b, err := migrations.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration %s: %w", entry.Name(), err)
+		}
+
+		m := Migration{
+			Version:     version,
+			Description: strings.ReplaceAll(match[2], "_", " "),
+		}
+		for _, batch := range batchSeparator.Split(strings.ReplaceAll(string(b), "$SCHEMA", schema), -1) {
+			if len(strings.TrimSpace(batch)) > 0 {
+				m.Batches = append(m.Batches, batch)
+			}
+		}
+
+		toReturn = append(toReturn, m)
+	}
+
+	sort.Slice(toReturn, func(i, j int) bool {
+		return toReturn[i].Version < toReturn[j].Version
+	})
+
+	return toReturn, nil
+}
+
+// SchemaVersion gets the version of the last migration applied to the database, or 0 if none have been.
+// It creates the schema version table if it doesn't exist yet.
+func (db *DB) SchemaVersion() (int, error) {
+	for _, q := range schemaVersionTable[db.Config.Driver] {
+		if _, err := db.Exec(strings.ReplaceAll(q, "$SCHEMA", db.Config.Schema)); err != nil {
+			return 0, fmt.Errorf("unable to create schema version table: %w", err)
+		}
+	}
+
+	var version int
+	err := db.Get(&version, `SELECT COALESCE(MAX(`+db.Quote("Version")+`), 0) FROM `+db.Table("SchemaVersion"))
+	if err != nil {
+		return 0, fmt.Errorf("unable to get schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Migrate applies each migration newer than the database's schema version, in order. Each migration is applied in its own transaction,
+// and it stops at the first one that fails. Returns the migrations that were applied.
+func (db *DB) Migrate() ([]Migration, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := Migrations(db.Config.Driver, db.Config.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, m := range all {
+		if m.Version <= current {
+			continue
+		}
+
+		log.L.Infof("Applying migration %v (%v) to %v", m.Version, m.Description, db.Config.Driver)
+		if err := db.apply(m); err != nil {
+			return applied, fmt.Errorf("unable to apply migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+func (db *DB) apply(m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to start txn: %w", err)
+	}
+
+	for i, batch := range m.Batches {
+		if _, err := tx.Exec(batch); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("batch %d failed: %w", i+1, err)
+		}
+	}
+
+	insert := db.Rebind(`INSERT INTO ` + db.Table("SchemaVersion") + ` (` + db.Quote("Version") + `, ` + db.Quote("Description") + `, ` + db.Quote("AppliedAt") + `) VALUES (?, ?, ?)`)
+	if _, err := tx.Exec(insert, m.Version, m.Description, time.Now()); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
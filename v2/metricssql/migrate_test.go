@@ -0,0 +1,42 @@
+package metricssql
+
+import "testing"
+
+func TestMigrate(t *testing.T) {
+	for _, driver := range []string{SQLServer, Postgres, SQLite} {
+		ms, err := Migrations(driver, "dbo")
+		if err != nil {
+			t.Fatalf("unable to get %v migrations: %v", driver, err)
+		}
+		for i := range ms {
+			if ms[i].Version != i+1 {
+				t.Errorf("expected %v migration %v to be version %v", driver, ms[i].Description, i+1)
+			}
+		}
+	}
+
+	db, err := Open(Config{Driver: SQLite, ConnectionString: ":memory:"})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatalf("expected migrations to be applied to an empty db")
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil || version != applied[len(applied)-1].Version {
+		t.Errorf("expected schema version %v, got %v: %v", applied[len(applied)-1].Version, version, err)
+	}
+
+	// nothing left to do the second time
+	applied, err = db.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("expected no migrations to be applied, got %v: %v", len(applied), err)
+	}
+}
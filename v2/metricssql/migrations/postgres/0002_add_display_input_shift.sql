@@ -0,0 +1,2 @@
+-- the named shift from the slicing config each record is in, empty if it isn't in one.
+ALTER TABLE "$SCHEMA"."DisplayInputMetrics" ADD COLUMN IF NOT EXISTS "Shift" TEXT NOT NULL DEFAULT '';
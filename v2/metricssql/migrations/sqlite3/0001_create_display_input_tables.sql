@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS "DisplayInputMetrics" (
+	"DeviceID"          TEXT        NOT NULL,
+	"RoomID"            TEXT        NOT NULL,
+	"BuildingID"        TEXT        NOT NULL,
+	"DeviceIDPrefix"    TEXT        NOT NULL,
+	"StartTime"         DATETIME    NOT NULL,
+	"EndTime"           DATETIME    NOT NULL,
+	"ExceptionDateType" TEXT        NOT NULL,
+	"StartHour"         INTEGER     NOT NULL,
+	"StartDayOfWeek"    INTEGER     NOT NULL,
+	"StartDay"          INTEGER     NOT NULL,
+	"StartMonth"        INTEGER     NOT NULL,
+	"StartYear"         INTEGER     NOT NULL,
+	"ElapsedSeconds"    INTEGER     NOT NULL,
+	"IsClass"           BOOLEAN     NOT NULL,
+	"TeachingArea"      TEXT        NOT NULL,
+	"CourseNumber"      TEXT        NOT NULL,
+	"SectionNumber"     TEXT        NOT NULL,
+	"ClassName"         TEXT        NOT NULL,
+	"ScheduleType"      TEXT        NOT NULL,
+	"InstructorName"    TEXT        NOT NULL,
+	"Power"             TEXT        NOT NULL,
+	"Blanked"           TEXT        NOT NULL,
+	"InputType"         TEXT        NOT NULL,
+	"Input"             TEXT        NOT NULL,
+	"InputActiveSignal" TEXT        NOT NULL,
+	"StatusDesc"        TEXT        NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "IX_DisplayInputMetrics_DeviceID_StartTime" ON "DisplayInputMetrics" ("DeviceID", "StartTime");
+
+CREATE TABLE IF NOT EXISTS "LastKnownStates" (
+	"LastKnownStateID"   INTEGER     PRIMARY KEY,
+	"DeviceID"           TEXT        NOT NULL UNIQUE,
+	"LastKnownStateTime" DATETIME    NOT NULL,
+	"LastKnownStateJSON" TEXT        NOT NULL
+);
@@ -0,0 +1,5 @@
+-- holidays, breaks, finals, etc. one row for each day, for the sql calendar source.
+CREATE TABLE IF NOT EXISTS "ExceptionDates" (
+	"ExceptionDate" DATE NOT NULL PRIMARY KEY,
+	"ExceptionType" TEXT NOT NULL
+);
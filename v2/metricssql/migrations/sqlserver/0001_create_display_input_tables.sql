@@ -0,0 +1,58 @@
+-- the tables may already exist from before migrations were tracked, so each object is only created if it's missing.
+IF OBJECT_ID(N'[$SCHEMA].[DisplayInputMetrics]', N'U') IS NULL
+CREATE TABLE [$SCHEMA].[DisplayInputMetrics] (
+	[DeviceID]          NVARCHAR(100)  NOT NULL,
+	[RoomID]            NVARCHAR(100)  NOT NULL,
+	[BuildingID]        NVARCHAR(50)   NOT NULL,
+	[DeviceIDPrefix]    NVARCHAR(50)   NOT NULL,
+	[StartTime]         DATETIMEOFFSET NOT NULL,
+	[EndTime]           DATETIMEOFFSET NOT NULL,
+	[ExceptionDateType] NVARCHAR(50)   NOT NULL,
+	[StartHour]         INT            NOT NULL,
+	[StartDayOfWeek]    INT            NOT NULL,
+	[StartDay]          INT            NOT NULL,
+	[StartMonth]        INT            NOT NULL,
+	[StartYear]         INT            NOT NULL,
+	[ElapsedSeconds]    INT            NOT NULL,
+	[IsClass]           BIT            NOT NULL,
+	[TeachingArea]      NVARCHAR(50)   NOT NULL,
+	[CourseNumber]      NVARCHAR(50)   NOT NULL,
+	[SectionNumber]     NVARCHAR(50)   NOT NULL,
+	[ClassName]         NVARCHAR(100)  NOT NULL,
+	[ScheduleType]      NVARCHAR(50)   NOT NULL,
+	[InstructorName]    NVARCHAR(250)  NOT NULL,
+	[Power]             NVARCHAR(50)   NOT NULL,
+	[Blanked]           NVARCHAR(50)   NOT NULL,
+	[InputType]         NVARCHAR(100)  NOT NULL,
+	[Input]             NVARCHAR(100)  NOT NULL,
+	[InputActiveSignal] NVARCHAR(50)   NOT NULL,
+	[StatusDesc]        NVARCHAR(250)  NOT NULL
+);
+GO
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = N'IX_DisplayInputMetrics_DeviceID_StartTime' AND object_id = OBJECT_ID(N'[$SCHEMA].[DisplayInputMetrics]'))
+CREATE INDEX [IX_DisplayInputMetrics_DeviceID_StartTime] ON [$SCHEMA].[DisplayInputMetrics] ([DeviceID], [StartTime]);
+GO
+IF OBJECT_ID(N'[$SCHEMA].[LastKnownStates]', N'U') IS NULL
+CREATE TABLE [$SCHEMA].[LastKnownStates] (
+	[LastKnownStateID]   INT IDENTITY(1, 1) PRIMARY KEY,
+	[DeviceID]           NVARCHAR(100)      NOT NULL UNIQUE,
+	[LastKnownStateTime] DATETIMEOFFSET     NOT NULL,
+	[LastKnownStateJSON] NVARCHAR(MAX)      NOT NULL
+);
+GO
+CREATE OR ALTER PROCEDURE [$SCHEMA].[UpdateLastKnownState]
+	@DeviceID           NVARCHAR(100),
+	@LastKnownStateTime DATETIMEOFFSET,
+	@LastKnownStateJSON NVARCHAR(MAX)
+AS
+BEGIN
+	SET NOCOUNT ON;
+
+	UPDATE [$SCHEMA].[LastKnownStates]
+	SET [LastKnownStateTime] = @LastKnownStateTime, [LastKnownStateJSON] = @LastKnownStateJSON
+	WHERE [DeviceID] = @DeviceID;
+
+	IF @@ROWCOUNT = 0
+		INSERT INTO [$SCHEMA].[LastKnownStates] ([DeviceID], [LastKnownStateTime], [LastKnownStateJSON])
+		VALUES (@DeviceID, @LastKnownStateTime, @LastKnownStateJSON);
+END
@@ -0,0 +1,3 @@
+-- the named shift from the slicing config each record is in, empty if it isn't in one.
+IF COL_LENGTH(N'[$SCHEMA].[DisplayInputMetrics]', N'Shift') IS NULL
+ALTER TABLE [$SCHEMA].[DisplayInputMetrics] ADD [Shift] NVARCHAR(50) NOT NULL CONSTRAINT [DF_DisplayInputMetrics_Shift] DEFAULT ('');
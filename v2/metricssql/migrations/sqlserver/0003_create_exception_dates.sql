@@ -0,0 +1,6 @@
+-- holidays, breaks, finals, etc. one row for each day, for the sql calendar source.
+IF OBJECT_ID(N'[$SCHEMA].[ExceptionDates]', N'U') IS NULL
+CREATE TABLE [$SCHEMA].[ExceptionDates] (
+	[ExceptionDate] DATE         NOT NULL PRIMARY KEY,
+	[ExceptionType] NVARCHAR(50) NOT NULL
+);
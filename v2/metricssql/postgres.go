@@ -0,0 +1,43 @@
+package metricssql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type postgres struct {
+	schema string
+}
+
+func (d postgres) Quote(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+func (d postgres) Table(name string) string {
+	return d.Quote(d.schema) + "." + d.Quote(name)
+}
+
+// BulkInsert uses COPY.
+func (d postgres) BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) (int, error) {
+	stmt, err := tx.Prepare(pq.CopyInSchema(d.schema, table, columns...))
+	if err != nil {
+		return 0, fmt.Errorf("unable to start copy: %w", err)
+	}
+
+	return copyRows(stmt, rows)
+}
+
+func (d postgres) UpsertLastKnownState(tx *sql.Tx, deviceID string, stateTime time.Time, state string) error {
+	_, err := tx.Exec(upsertLastKnownStateQuery(d, "$1", "$2", "$3"), deviceID, stateTime, state)
+	return err
+}
+
+// upsertLastKnownStateQuery builds an INSERT ... ON CONFLICT query for the LastKnownStates table, which postgres and sqlite both understand.
+func upsertLastKnownStateQuery(d Dialect, p1, p2, p3 string) string {
+	return fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s) VALUES (%[5]s, %[6]s, %[7]s)
+		ON CONFLICT (%[2]s) DO UPDATE SET %[3]s = excluded.%[3]s, %[4]s = excluded.%[4]s`,
+		d.Table("LastKnownStates"), d.Quote("DeviceID"), d.Quote("LastKnownStateTime"), d.Quote("LastKnownStateJSON"), p1, p2, p3)
+}
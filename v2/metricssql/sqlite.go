@@ -0,0 +1,50 @@
+package metricssql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" //load driver
+)
+
+type sqlite struct{}
+
+func (d sqlite) Quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Table ignores the schema, sqlite doesn't have them.
+func (d sqlite) Table(name string) string {
+	return d.Quote(name)
+}
+
+// BulkInsert uses a prepared insert. sqlite is fast enough at that inside of a transaction.
+func (d sqlite) BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) (int, error) {
+	quoted := make([]string, len(columns))
+	for i := range columns {
+		quoted[i] = d.Quote(columns[i])
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.Table(table), strings.Join(quoted, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i := range rows {
+		if _, err := stmt.Exec(rows[i]...); err != nil {
+			return 0, fmt.Errorf("unable to insert row %d: %w", i, err)
+		}
+	}
+
+	return len(rows), nil
+}
+
+func (d sqlite) UpsertLastKnownState(tx *sql.Tx, deviceID string, stateTime time.Time, state string) error {
+	_, err := tx.Exec(upsertLastKnownStateQuery(d, "?", "?", "?"), deviceID, stateTime, state)
+	return err
+}
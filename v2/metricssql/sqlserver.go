@@ -0,0 +1,59 @@
+package metricssql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+type sqlServer struct {
+	schema string
+}
+
+func (d sqlServer) Quote(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (d sqlServer) Table(name string) string {
+	return d.Quote(d.schema) + "." + d.Quote(name)
+}
+
+// BulkInsert uses the bulk copy protocol.
+func (d sqlServer) BulkInsert(tx *sql.Tx, table string, columns []string, rows [][]interface{}) (int, error) {
+	stmt, err := tx.Prepare(mssql.CopyIn(d.Table(table), mssql.BulkOptions{}, columns...))
+	if err != nil {
+		return 0, fmt.Errorf("unable to start copy in: %w", err)
+	}
+
+	return copyRows(stmt, rows)
+}
+
+// UpsertLastKnownState uses the UpdateLastKnownState procedure.
+func (d sqlServer) UpsertLastKnownState(tx *sql.Tx, deviceID string, stateTime time.Time, state string) error {
+	_, err := tx.Exec(`EXEC `+d.Table("UpdateLastKnownState")+` @p1, @p2, @p3`, deviceID, stateTime, state)
+	return err
+}
+
+// copyRows sends each row to a prepared copy statement, then flushes it.
+func copyRows(stmt *sql.Stmt, rows [][]interface{}) (int, error) {
+	defer stmt.Close()
+
+	for i := range rows {
+		if _, err := stmt.Exec(rows[i]...); err != nil {
+			return 0, fmt.Errorf("unable to copy row %d: %w", i, err)
+		}
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return 0, fmt.Errorf("unable to flush copy: %w", err)
+	}
+
+	if err := stmt.Close(); err != nil {
+		return 0, fmt.Errorf("unable to close copy: %w", err)
+	}
+
+	return len(rows), nil
+}
@@ -1,4 +1,4 @@
-package caterpillarmssql
+package metricssql
 
 import (
 	"testing"
@@ -10,7 +10,7 @@ import (
 func TestLoadMSSQL(t *testing.T) {
 	log.SetLevel("debug")
 	log.L.Debugf("Connecting to DB")
-	db, err := GetDB()
+	db, err := Open(Config{Driver: SQLServer})
 	if err != nil {
 		log.L.Fatalf("Error %v", err.Error())
 		return
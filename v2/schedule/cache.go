@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+
+	"github.com/byuoitav/common/log"
+)
+
+// CacheTTL is how long the providers from Get keep a room's classes for a day.
+var CacheTTL = time.Hour
+
+// Cache keeps the classes for each room and day from a provider for a while, so the provider isn't asked again each time a record is sliced.
+// Errors aren't cached.
+type Cache struct {
+	Provider Provider
+	TTL      time.Duration
+
+	mu   sync.Mutex
+	days map[cacheKey]cachedDay
+}
+
+type cacheKey struct {
+	room string
+	day  int64
+}
+
+type cachedDay struct {
+	classes []Class
+	fetched time.Time
+}
+
+// NewCache wraps p in a cache.
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	return &Cache{
+		Provider: p,
+		TTL:      ttl,
+		days:     map[cacheKey]cachedDay{},
+	}
+}
+
+// ClassesForDay fulfills the Provider interface.
+func (c *Cache) ClassesForDay(room string, day time.Time) ([]Class, error) {
+	key := cacheKey{room: room, day: day.Unix()}
+
+	c.mu.Lock()
+	cached, ok := c.days[key]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.fetched) < c.TTL {
+		return cached.classes, nil
+	}
+
+	// the lock isn't held while fetching, so a slow provider doesn't hold up rooms that are already cached.
+	classes, err := c.Provider.ClassesForDay(room, day)
+	if err != nil {
+		log.L.Warnf("Unable to get classes for %v on %v: %v", room, day.Format("2006-01-02"), err)
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.days[key] = cachedDay{classes: classes, fetched: time.Now()}
+	c.sweep()
+
+	return classes, nil
+}
+
+// sweep drops expired days once the cache gets big. c.mu must be held.
+func (c *Cache) sweep() {
+	if len(c.days) < 10000 {
+		return
+	}
+
+	for k, v := range c.days {
+		if time.Since(v.fetched) >= c.TTL {
+			delete(c.days, k)
+		}
+	}
+}
+
+var (
+	caches   = map[string]*Cache{}
+	cachesMu sync.Mutex
+)
+
+// Get gets a cached provider for a source (see ProviderFor). Each source has one cache shared by everyone that uses it.
+func Get(source string) (Provider, error) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	if c, ok := caches[source]; ok {
+		return c, nil
+	}
+
+	p, err := ProviderFor(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCache(p, CacheTTL)
+	caches[source] = c
+	return c, nil
+}
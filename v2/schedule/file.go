@@ -0,0 +1,129 @@
+package schedule
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// File is a schedule read from a local file, for tests and offline backfills.
+//
+// A .json file is a list of classes (see Class for the field names). A .csv file has rows of
+// room,start,end,teaching-area,course-number,section-number,schedule-type,instructors with times in RFC 3339 and instructors separated by |.
+// A header row starting with "room" is skipped.
+type File struct {
+	rooms map[string][]Class
+}
+
+// NewFile reads the schedule in the file at p.
+func NewFile(p string) (*File, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open class schedule: %w", err)
+	}
+	defer f.Close()
+
+	var classes []Class
+	switch strings.ToLower(path.Ext(p)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&classes)
+	case ".csv":
+		classes, err = parseCSV(f)
+	default:
+		return nil, fmt.Errorf("unknown class schedule format %q, must be .json or .csv", p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read class schedule %s: %w", p, err)
+	}
+
+	return NewStatic(classes), nil
+}
+
+// NewStatic is a schedule of the classes given.
+func NewStatic(classes []Class) *File {
+	toReturn := &File{rooms: map[string][]Class{}}
+	for _, c := range classes {
+		toReturn.rooms[c.Room] = append(toReturn.rooms[c.Room], c)
+	}
+
+	for room := range toReturn.rooms {
+		sortClasses(toReturn.rooms[room])
+	}
+
+	return toReturn
+}
+
+// ClassesForDay fulfills the Provider interface.
+func (f *File) ClassesForDay(room string, day time.Time) ([]Class, error) {
+	end := day.AddDate(0, 0, 1)
+
+	toReturn := []Class{}
+	for _, c := range f.rooms[room] {
+		if c.Start.Before(end) && c.End.After(day) {
+			toReturn = append(toReturn, c)
+		}
+	}
+
+	return toReturn, nil
+}
+
+func parseCSV(r io.Reader) ([]Class, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	toReturn := []Class{}
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if row == 1 && strings.EqualFold(strings.TrimSpace(fields[0]), "room") {
+			continue
+		}
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("row %d has %d fields, need at least room,start,end,teaching-area,course-number", row, len(fields))
+		}
+		for len(fields) < 8 {
+			fields = append(fields, "")
+		}
+
+		c := Class{
+			Room:          strings.TrimSpace(fields[0]),
+			TeachingArea:  strings.TrimSpace(fields[3]),
+			CourseNumber:  strings.TrimSpace(fields[4]),
+			SectionNumber: strings.TrimSpace(fields[5]),
+			ScheduleType:  strings.TrimSpace(fields[6]),
+		}
+
+		if c.Start, err = time.Parse(time.RFC3339, strings.TrimSpace(fields[1])); err != nil {
+			return nil, fmt.Errorf("invalid start on row %d: %w", row, err)
+		}
+		if c.End, err = time.Parse(time.RFC3339, strings.TrimSpace(fields[2])); err != nil {
+			return nil, fmt.Errorf("invalid end on row %d: %w", row, err)
+		}
+		if !c.End.After(c.Start) {
+			return nil, fmt.Errorf("row %d doesn't end after it starts", row)
+		}
+
+		for _, instructor := range strings.Split(fields[7], "|") {
+			if instructor = strings.TrimSpace(instructor); len(instructor) > 0 {
+				c.Instructors = append(c.Instructors, instructor)
+			}
+		}
+
+		toReturn = append(toReturn, c)
+	}
+
+	return toReturn, nil
+}
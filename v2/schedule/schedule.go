@@ -0,0 +1,96 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var location *time.Location
+
+func init() {
+	var err error
+	location, err = time.LoadLocation("America/Denver")
+	if err != nil {
+		panic("unable to load timezone: " + err.Error())
+	}
+}
+
+// Class is one meeting of a class in a room.
+type Class struct {
+	Room  string    `json:"room"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	TeachingArea  string   `json:"teaching-area"`
+	CourseNumber  string   `json:"course-number"`
+	SectionNumber string   `json:"section-number,omitempty"`
+	ScheduleType  string   `json:"schedule-type,omitempty"`
+	Instructors   []string `json:"instructors,omitempty"`
+
+	CreditHours float64 `json:"credit-hours,omitempty"`
+	SectionSize int     `json:"section-size,omitempty"`
+	Enrollment  int     `json:"enrollment,omitempty"`
+}
+
+// Provider gets the classes that meet in a room.
+type Provider interface {
+	// ClassesForDay gets the classes that meet in the room on the day starting at midnight day, in order.
+	ClassesForDay(room string, day time.Time) ([]Class, error)
+}
+
+// Classes gets the classes that meet in the room any time between start and end, in order.
+func Classes(p Provider, room string, start, end time.Time) ([]Class, error) {
+	toReturn := []Class{}
+	seen := map[string]bool{}
+
+	for day := StartOfDay(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		classes, err := p.ClassesForDay(room, day)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get classes for %s on %s: %w", room, day.Format("2006-01-02"), err)
+		}
+
+		for _, class := range classes {
+			// classes that run past midnight come back for both days
+			key := fmt.Sprintf("%s|%s|%s|%d|%d", class.TeachingArea, class.CourseNumber, class.SectionNumber, class.Start.Unix(), class.End.Unix())
+			if seen[key] {
+				continue
+			}
+
+			if class.End.After(start) && class.Start.Before(end) {
+				seen[key] = true
+				toReturn = append(toReturn, class)
+			}
+		}
+	}
+
+	sortClasses(toReturn)
+	return toReturn, nil
+}
+
+// StartOfDay gets midnight at the start of t's day, in Denver.
+func StartOfDay(t time.Time) time.Time {
+	y, m, d := t.In(location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, location)
+}
+
+// ProviderFor gets the provider for a class schedule source: registar or uapi for the WSO2 apis, or the path of a .json or .csv file.
+func ProviderFor(source string) (Provider, error) {
+	switch strings.TrimSpace(source) {
+	case "":
+		return nil, fmt.Errorf("no class schedule source")
+	case "registar":
+		return Registar{}, nil
+	case "uapi":
+		return UAPI{}, nil
+	}
+
+	return NewFile(source)
+}
+
+func sortClasses(classes []Class) {
+	sort.SliceStable(classes, func(i, j int) bool {
+		return classes[i].Start.Before(classes[j].Start)
+	})
+}
@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	Provider
+	calls int
+	fail  bool
+}
+
+func (c *countingProvider) ClassesForDay(room string, day time.Time) ([]Class, error) {
+	c.calls++
+	if c.fail {
+		return nil, errors.New("wso2 is down")
+	}
+	return c.Provider.ClassesForDay(room, day)
+}
+
+func TestClasses(t *testing.T) {
+	classes, err := parseCSV(strings.NewReader(`room,start,end,teaching-area,course-number,section-number,schedule-type,instructors
+ITB-1101,2019-09-03T23:00:00-06:00,2019-09-04T01:00:00-06:00,C S,142,001,LEC,Ada Lovelace|Alan Turing
+ITB-1101,2019-09-03T08:00:00-06:00,2019-09-03T08:50:00-06:00,C S,124,002,LEC,
+ITB-1106,2019-09-03T08:00:00-06:00,2019-09-03T08:50:00-06:00,EC EN,220,001,LAB,
+`))
+	if err != nil {
+		t.Fatalf("unable to parse csv: %v", err)
+	}
+
+	counter := &countingProvider{Provider: NewStatic(classes)}
+	cache := NewCache(counter, time.Hour)
+
+	start := time.Date(2019, 9, 3, 7, 0, 0, 0, location)
+	got, err := Classes(cache, "ITB-1101", start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("unable to get classes: %v", err)
+	}
+	if len(got) != 2 || got[0].CourseNumber != "124" || got[1].CourseNumber != "142" {
+		t.Fatalf("expected 124 then 142, got %+v", got)
+	}
+	if len(got[1].Instructors) != 2 {
+		t.Errorf("expected 2 instructors, got %v", got[1].Instructors)
+	}
+
+	// the class that runs past midnight shows up on both days, but only once in the block
+	got, err = Classes(cache, "ITB-1101", start.Add(15*time.Hour), start.Add(18*time.Hour))
+	if err != nil || len(got) != 1 {
+		t.Errorf("expected the late class, got %+v: %v", got, err)
+	}
+
+	calls := counter.calls
+	if _, err := Classes(cache, "ITB-1101", start, start.Add(time.Hour)); err != nil || counter.calls != calls {
+		t.Errorf("expected the day to be cached, provider was called %v more times", counter.calls-calls)
+	}
+
+	counter.fail = true
+	if _, err := Classes(cache, "ITB-1101", start.AddDate(0, 0, 7), start.AddDate(0, 0, 8)); err == nil {
+		t.Errorf("expected the provider's error to be returned")
+	}
+}
+
+func TestWallClock(t *testing.T) {
+	api := time.FixedZone("", -7*60*60)
+	mst, _ := time.LoadLocation("MST")
+
+	tests := []struct {
+		in, out time.Time
+	}{
+		{time.Date(2019, 9, 3, 9, 0, 0, 0, api), time.Date(2019, 9, 3, 9, 0, 0, 0, location)},
+		{time.Date(2019, 12, 3, 9, 0, 0, 0, api), time.Date(2019, 12, 3, 9, 0, 0, 0, location)},
+		{time.Date(2019, 9, 3, 9, 0, 0, 0, mst), time.Date(2019, 9, 3, 10, 0, 0, 0, location)},
+		{time.Date(2019, 9, 3, 15, 0, 0, 0, time.UTC), time.Date(2019, 9, 3, 9, 0, 0, 0, location)},
+	}
+
+	for _, tt := range tests {
+		if out := wallClock(tt.in); !out.Equal(tt.out) {
+			t.Errorf("expected %v to be read as %v, got %v", tt.in, tt.out, out)
+		}
+	}
+}
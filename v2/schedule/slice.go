@@ -0,0 +1,286 @@
+package schedule
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slice is a piece of a time range, with the classes meeting in it.
+type Slice struct {
+	Start time.Time
+	End   time.Time
+	Shift string // the name of the shift the slice is in, if any.
+
+	// Classes are the classes meeting in the slice, in order. There's more than one when sections overlap, e.g. cross-listed courses that share a room.
+	// When the slicer splits on class boundaries they meet for the whole slice, otherwise they meet for at least part of it.
+	Classes []Class
+}
+
+// Composite combines the slice's classes into one, see Composite.
+func (s Slice) Composite() (Class, bool) {
+	return Composite(s.Classes)
+}
+
+// Shift is a named part of each day, e.g. evening classes from 17:00 to 22:00. Shifts that end before they start run past midnight.
+type Shift struct {
+	Name  string
+	Start time.Duration // since midnight, on the wall clock.
+	End   time.Duration
+}
+
+// Slicer splits time ranges on class boundaries, midnight, every interval of the day, and shifts. The zero Slicer doesn't split at all.
+// Midnight, the intervals, and shifts are in Denver, so days are 23 or 25 hours long across daylight saving time changes.
+type Slicer struct {
+	Classes  bool          // split at every class start and end.
+	Midnight bool          // split at midnight.
+	Every    time.Duration // split every interval from midnight, e.g. time.Hour. 0 for none.
+	Shifts   []Shift       // split at the start and end of each shift, and name the slices in them.
+}
+
+type shiftTime struct {
+	name       string
+	start, end time.Time
+}
+
+// Slice splits start to end into slices at the boundaries the slicer is configured with.
+// Time without a class is still sliced, with no classes.
+func (s Slicer) Slice(start, end time.Time, classes []Class) []Slice {
+	if !end.After(start) {
+		return nil
+	}
+
+	valid := make([]Class, 0, len(classes))
+	for _, c := range classes {
+		if c.End.After(c.Start) {
+			valid = append(valid, c)
+		}
+	}
+	sortClasses(valid)
+
+	boundaries := []time.Time{start, end}
+	if s.Classes {
+		for _, c := range valid {
+			boundaries = append(boundaries, c.Start, c.End)
+		}
+	}
+
+	shifts := []shiftTime{}
+
+	// start the day before so shifts that run past midnight into the range are found
+	for day := StartOfDay(start).AddDate(0, 0, -1); day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+
+		if s.Midnight || s.Every > 0 {
+			boundaries = append(boundaries, day)
+		}
+		if s.Every > 0 && time.Hour%s.Every == 0 {
+			// Denver is always a whole number of hours off UTC, so these stay on the wall clock, and both 1:00 hours are split when the clocks fall back.
+			for t := day.Add(s.Every); t.Before(next); t = t.Add(s.Every) {
+				boundaries = append(boundaries, t)
+			}
+		} else if s.Every > 0 {
+			for d := s.Every; d < 24*time.Hour; d += s.Every {
+				boundaries = append(boundaries, wallTime(day, d))
+			}
+		}
+
+		for _, shift := range s.Shifts {
+			st := shiftTime{name: shift.Name, start: wallTime(day, shift.Start), end: wallTime(day, shift.End)}
+			if !st.end.After(st.start) {
+				st.end = wallTime(next, shift.End)
+			}
+
+			shifts = append(shifts, st)
+			boundaries = append(boundaries, st.start, st.end)
+		}
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+
+	toReturn := []Slice{}
+	for i := 1; i < len(boundaries); i++ {
+		from, to := boundaries[i-1], boundaries[i]
+		if !from.After(start) {
+			from = start
+		}
+		if !to.Before(end) {
+			to = end
+		}
+
+		if !to.After(from) {
+			continue
+		}
+
+		slice := Slice{Start: from, End: to}
+		for _, c := range valid {
+			if s.Classes && !c.Start.After(from) && !c.End.Before(to) {
+				slice.Classes = append(slice.Classes, c)
+			} else if !s.Classes && c.Start.Before(to) && c.End.After(from) {
+				slice.Classes = append(slice.Classes, c)
+			}
+		}
+
+		for _, st := range shifts {
+			if !from.Before(st.start) && from.Before(st.end) {
+				slice.Shift = st.name
+				break
+			}
+		}
+
+		toReturn = append(toReturn, slice)
+	}
+
+	return toReturn
+}
+
+// wallTime gets the time d after midnight on day on the wall clock, which isn't day.Add(d) on days daylight saving time changes.
+// A time in the hour skipped when the clocks spring forward is moved past it, time.Date would move it back an hour instead.
+func wallTime(day time.Time, d time.Duration) time.Time {
+	y, m, dd := day.Date()
+	t := time.Date(y, m, dd, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, location)
+	if t.Hour() != int(d/time.Hour)%24 {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+// Composite combines classes that meet at the same time into one, e.g. cross-listed sections of the same course.
+// The class info is joined with "/" (instructors are merged), the size and enrollment are summed, and it runs from the earliest start to the latest end.
+// It returns false if there aren't any classes.
+func Composite(classes []Class) (Class, bool) {
+	switch len(classes) {
+	case 0:
+		return Class{}, false
+	case 1:
+		return classes[0], true
+	}
+
+	toReturn := Class{
+		Room:  classes[0].Room,
+		Start: classes[0].Start,
+		End:   classes[0].End,
+	}
+
+	var areas, courses, sections, types []string
+	for _, c := range classes {
+		if c.Start.Before(toReturn.Start) {
+			toReturn.Start = c.Start
+		}
+		if c.End.After(toReturn.End) {
+			toReturn.End = c.End
+		}
+
+		areas = appendUnique(areas, c.TeachingArea)
+		courses = appendUnique(courses, c.CourseNumber)
+		sections = appendUnique(sections, c.SectionNumber)
+		types = appendUnique(types, c.ScheduleType)
+		for _, i := range c.Instructors {
+			toReturn.Instructors = appendUnique(toReturn.Instructors, i)
+		}
+
+		if c.CreditHours > toReturn.CreditHours {
+			toReturn.CreditHours = c.CreditHours
+		}
+		toReturn.SectionSize += c.SectionSize
+		toReturn.Enrollment += c.Enrollment
+	}
+
+	toReturn.TeachingArea = strings.Join(areas, "/")
+	toReturn.CourseNumber = strings.Join(courses, "/")
+	toReturn.SectionNumber = strings.Join(sections, "/")
+	toReturn.ScheduleType = strings.Join(types, "/")
+
+	return toReturn, true
+}
+
+func appendUnique(s []string, v string) []string {
+	if len(v) == 0 {
+		return s
+	}
+
+	for i := range s {
+		if s[i] == v {
+			return s
+		}
+	}
+
+	return append(s, v)
+}
+
+var shiftRule = regexp.MustCompile(`^(.*\S)\s+(\d{1,2}):(\d{2})\s*-\s*(\d{1,2}):(\d{2})$`)
+
+// ParseSlicer builds a slicer from a comma separated list of rules:
+//
+//	none      - don't split at all, the same as an empty list.
+//	class     - split at class boundaries.
+//	midnight  - split at midnight.
+//	hourly    - split every hour.
+//	15m       - split every duration, e.g. 15m or 4h. It has to evenly divide a day.
+//	name HH:MM-HH:MM - a named shift, e.g. "evening classes 17:00-22:00".
+func ParseSlicer(rules string) (Slicer, error) {
+	toReturn := Slicer{}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+
+		switch strings.ToLower(rule) {
+		case "", "none":
+			continue
+		case "class", "classes":
+			toReturn.Classes = true
+			continue
+		case "midnight":
+			toReturn.Midnight = true
+			continue
+		case "hourly":
+			toReturn.Every = time.Hour
+			continue
+		}
+
+		if match := shiftRule.FindStringSubmatch(rule); match != nil {
+			shift := Shift{Name: match[1]}
+			var err error
+
+			if shift.Start, err = clock(match[2], match[3]); err != nil {
+				return toReturn, fmt.Errorf("invalid shift %q: %w", rule, err)
+			}
+			if shift.End, err = clock(match[4], match[5]); err != nil {
+				return toReturn, fmt.Errorf("invalid shift %q: %w", rule, err)
+			}
+			if shift.Start == shift.End {
+				return toReturn, fmt.Errorf("invalid shift %q: it doesn't have any time in it", rule)
+			}
+
+			toReturn.Shifts = append(toReturn.Shifts, shift)
+			continue
+		}
+
+		every, err := time.ParseDuration(rule)
+		if err != nil {
+			return toReturn, fmt.Errorf("unknown slicing rule %q", rule)
+		}
+		if every <= 0 || (24*time.Hour)%every != 0 {
+			return toReturn, fmt.Errorf("invalid slicing interval %q, it must evenly divide a day", rule)
+		}
+
+		toReturn.Every = every
+	}
+
+	return toReturn, nil
+}
+
+func clock(hour, minute string) (time.Duration, error) {
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	if h > 24 || m > 59 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("%s:%s isn't a time of day", hour, minute)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
@@ -0,0 +1,287 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func denver(y int, m time.Month, d, h, min int) time.Time {
+	return time.Date(y, m, d, h, min, 0, 0, location)
+}
+
+func class(course string, start, end time.Time) Class {
+	return Class{Room: "ITB-1101", TeachingArea: "C S", CourseNumber: course, Start: start, End: end}
+}
+
+func TestSlice(t *testing.T) {
+	mst := time.FixedZone("", -7*60*60)
+
+	tests := []struct {
+		name    string
+		slicer  Slicer
+		start   time.Time
+		end     time.Time
+		classes []Class
+
+		slices  int
+		classAt map[time.Time][]string // course numbers meeting in the slice starting at the time
+		shiftAt map[time.Time]string   // the shift the slice starting at the time is in
+	}{
+		{
+			name:   "no classes",
+			start:  denver(2019, 9, 3, 8, 0),
+			end:    denver(2019, 9, 3, 10, 0),
+			slices: 1,
+		},
+		{
+			name:    "class in the middle",
+			slicer:  Slicer{Classes: true},
+			start:   denver(2019, 9, 3, 8, 0),
+			end:     denver(2019, 9, 3, 10, 0),
+			classes: []Class{class("142", denver(2019, 9, 3, 8, 30), denver(2019, 9, 3, 9, 20))},
+			slices:  3,
+			classAt: map[time.Time][]string{
+				denver(2019, 9, 3, 8, 0):  nil,
+				denver(2019, 9, 3, 8, 30): {"142"},
+				denver(2019, 9, 3, 9, 20): nil,
+			},
+		},
+		{
+			name:    "class started before the range",
+			slicer:  Slicer{Classes: true},
+			start:   denver(2019, 9, 3, 9, 0),
+			end:     denver(2019, 9, 3, 10, 0),
+			classes: []Class{class("142", denver(2019, 9, 3, 8, 30), denver(2019, 9, 3, 9, 20))},
+			slices:  2,
+			classAt: map[time.Time][]string{
+				denver(2019, 9, 3, 9, 0):  {"142"},
+				denver(2019, 9, 3, 9, 20): nil,
+			},
+		},
+		{
+			name:   "overlapping sections",
+			slicer: Slicer{Classes: true},
+			start:  denver(2019, 9, 3, 8, 0),
+			end:    denver(2019, 9, 3, 10, 0),
+			classes: []Class{
+				class("142", denver(2019, 9, 3, 8, 0), denver(2019, 9, 3, 9, 0)),
+				class("240", denver(2019, 9, 3, 8, 30), denver(2019, 9, 3, 9, 30)),
+			},
+			slices: 4,
+			classAt: map[time.Time][]string{
+				denver(2019, 9, 3, 8, 0):  {"142"},
+				denver(2019, 9, 3, 8, 30): {"142", "240"},
+				denver(2019, 9, 3, 9, 0):  {"240"},
+				denver(2019, 9, 3, 9, 30): nil,
+			},
+		},
+		{
+			name:   "cross-listed",
+			slicer: Slicer{Classes: true},
+			start:  denver(2019, 9, 3, 8, 0),
+			end:    denver(2019, 9, 3, 9, 0),
+			classes: []Class{
+				class("142", denver(2019, 9, 3, 8, 0), denver(2019, 9, 3, 9, 0)),
+				class("542", denver(2019, 9, 3, 8, 0), denver(2019, 9, 3, 9, 0)),
+			},
+			slices:  1,
+			classAt: map[time.Time][]string{denver(2019, 9, 3, 8, 0): {"142", "542"}},
+		},
+		{
+			name:    "classes without class boundaries",
+			slicer:  Slicer{Midnight: true},
+			start:   denver(2019, 9, 3, 8, 0),
+			end:     denver(2019, 9, 3, 10, 0),
+			classes: []Class{class("142", denver(2019, 9, 3, 8, 30), denver(2019, 9, 3, 9, 20))},
+			slices:  1,
+			classAt: map[time.Time][]string{denver(2019, 9, 3, 8, 0): {"142"}},
+		},
+		{
+			name:    "class spans midnight",
+			slicer:  Slicer{Classes: true, Midnight: true},
+			start:   denver(2019, 9, 3, 22, 0),
+			end:     denver(2019, 9, 4, 2, 0),
+			classes: []Class{class("142", denver(2019, 9, 3, 23, 0), denver(2019, 9, 4, 1, 0))},
+			slices:  4,
+			classAt: map[time.Time][]string{
+				denver(2019, 9, 3, 22, 0): nil,
+				denver(2019, 9, 3, 23, 0): {"142"},
+				denver(2019, 9, 4, 0, 0):  {"142"},
+				denver(2019, 9, 4, 1, 0):  nil,
+			},
+		},
+		{
+			name:   "hourly across spring forward",
+			slicer: Slicer{Every: time.Hour, Midnight: true},
+			start:  denver(2019, 3, 10, 0, 0),
+			end:    denver(2019, 3, 11, 0, 0),
+			slices: 23,
+		},
+		{
+			name:   "hourly across fall back",
+			slicer: Slicer{Every: time.Hour, Midnight: true},
+			start:  denver(2019, 11, 3, 0, 0),
+			end:    denver(2019, 11, 4, 0, 0),
+			slices: 25,
+		},
+		{
+			name:    "every 2 hours across fall back",
+			slicer:  Slicer{Every: 2 * time.Hour},
+			start:   denver(2019, 11, 3, 0, 0),
+			end:     denver(2019, 11, 4, 0, 0),
+			slices:  12,
+			classAt: map[time.Time][]string{denver(2019, 11, 3, 14, 0): nil},
+		},
+		{
+			name:    "every 2 hours across spring forward",
+			slicer:  Slicer{Every: 2 * time.Hour},
+			start:   denver(2019, 3, 10, 0, 0),
+			end:     denver(2019, 3, 11, 0, 0),
+			slices:  12,
+			classAt: map[time.Time][]string{denver(2019, 3, 10, 3, 0): nil, denver(2019, 3, 10, 4, 0): nil},
+		},
+		{
+			name:   "overnight shift",
+			slicer: Slicer{Shifts: []Shift{{Name: "night", Start: 22 * time.Hour, End: 6 * time.Hour}}},
+			start:  denver(2019, 9, 3, 20, 0),
+			end:    denver(2019, 9, 4, 8, 0),
+			slices: 3,
+			shiftAt: map[time.Time]string{
+				denver(2019, 9, 3, 20, 0): "",
+				denver(2019, 9, 3, 22, 0): "night",
+				denver(2019, 9, 4, 6, 0):  "",
+			},
+		},
+		{
+			name:    "shift on the wall clock across spring forward",
+			slicer:  Slicer{Shifts: []Shift{{Name: "evening classes", Start: 17 * time.Hour, End: 22 * time.Hour}}},
+			start:   denver(2019, 3, 10, 0, 0),
+			end:     denver(2019, 3, 11, 0, 0),
+			slices:  3,
+			shiftAt: map[time.Time]string{denver(2019, 3, 10, 17, 0): "evening classes"},
+		},
+		{
+			// only the wso2 providers' times are read as wall clock time, see wallClock
+			name:    "fixed mst offset during daylight saving time",
+			slicer:  Slicer{Classes: true},
+			start:   denver(2019, 9, 3, 8, 0),
+			end:     denver(2019, 9, 3, 10, 0),
+			classes: []Class{class("142", time.Date(2019, 9, 3, 8, 0, 0, 0, mst), time.Date(2019, 9, 3, 8, 50, 0, 0, mst))},
+			slices:  3,
+			classAt: map[time.Time][]string{denver(2019, 9, 3, 9, 0): {"142"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slices := tt.slicer.Slice(tt.start, tt.end, tt.classes)
+			if len(slices) != tt.slices {
+				t.Fatalf("expected %v slices, got %v: %+v", tt.slices, len(slices), slices)
+			}
+
+			// the slices have to cover the whole range without gaps
+			if !slices[0].Start.Equal(tt.start) || !slices[len(slices)-1].End.Equal(tt.end) {
+				t.Errorf("slices run from %v to %v", slices[0].Start, slices[len(slices)-1].End)
+			}
+			for i := 1; i < len(slices); i++ {
+				if !slices[i].Start.Equal(slices[i-1].End) {
+					t.Errorf("gap between %v and %v", slices[i-1].End, slices[i].Start)
+				}
+			}
+
+			for start, courses := range tt.classAt {
+				found := false
+				for _, s := range slices {
+					if !s.Start.Equal(start) {
+						continue
+					}
+
+					found = true
+					if len(s.Classes) != len(courses) {
+						t.Fatalf("expected %v at %v, got %+v", courses, start, s.Classes)
+					}
+					for i := range courses {
+						if s.Classes[i].CourseNumber != courses[i] {
+							t.Errorf("expected %v at %v, got %v", courses[i], start, s.Classes[i].CourseNumber)
+						}
+					}
+				}
+
+				if !found {
+					t.Errorf("no slice starts at %v", start)
+				}
+			}
+
+			for start, shift := range tt.shiftAt {
+				found := false
+				for _, s := range slices {
+					if s.Start.Equal(start) {
+						found = true
+						if s.Shift != shift {
+							t.Errorf("expected shift %q at %v, got %q", shift, start, s.Shift)
+						}
+					}
+				}
+
+				if !found {
+					t.Errorf("no slice starts at %v", start)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSlicer(t *testing.T) {
+	tests := []struct {
+		rules   string
+		slicer  Slicer
+		invalid bool
+	}{
+		{rules: "", slicer: Slicer{}},
+		{rules: "none", slicer: Slicer{}},
+		{rules: "class, midnight", slicer: Slicer{Classes: true, Midnight: true}},
+		{rules: "hourly,class", slicer: Slicer{Classes: true, Every: time.Hour}},
+		{rules: "15m", slicer: Slicer{Every: 15 * time.Minute}},
+		{rules: "evening classes 17:00-22:00", slicer: Slicer{Shifts: []Shift{{Name: "evening classes", Start: 17 * time.Hour, End: 22 * time.Hour}}}},
+		{rules: "7m", invalid: true},
+		{rules: "night 25:00-06:00", invalid: true},
+		{rules: "fortnightly", invalid: true},
+	}
+
+	for _, tt := range tests {
+		slicer, err := ParseSlicer(tt.rules)
+		switch {
+		case tt.invalid && err == nil:
+			t.Errorf("expected %q to be invalid", tt.rules)
+		case !tt.invalid && err != nil:
+			t.Errorf("unable to parse %q: %v", tt.rules, err)
+		case !tt.invalid && !reflect.DeepEqual(slicer, tt.slicer):
+			t.Errorf("%q: expected %+v, got %+v", tt.rules, tt.slicer, slicer)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	start := denver(2019, 9, 3, 8, 0)
+
+	a := class("142", start, start.Add(50*time.Minute))
+	a.Instructors = []string{"Ada Lovelace"}
+	a.Enrollment = 30
+	b := class("542", start, start.Add(time.Hour))
+	b.TeachingArea = "EC EN"
+	b.Instructors = []string{"Ada Lovelace", "Alan Turing"}
+	b.Enrollment = 10
+
+	c, ok := Composite([]Class{a, b})
+	if !ok {
+		t.Fatalf("expected a composite class")
+	}
+	if c.TeachingArea != "C S/EC EN" || c.CourseNumber != "142/542" || len(c.Instructors) != 2 || c.Enrollment != 40 || !c.End.Equal(b.End) {
+		t.Errorf("unexpected composite: %+v", c)
+	}
+
+	if _, ok := Composite(nil); ok {
+		t.Errorf("expected no composite without classes")
+	}
+}
@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/byuoitav/wso2services/classschedules/registar"
+	"github.com/byuoitav/wso2services/classschedules/uapiclassschedule"
+)
+
+// Registar gets classes from the registar's class schedule api.
+type Registar struct{}
+
+// ClassesForDay fulfills the Provider interface.
+func (Registar) ClassesForDay(room string, day time.Time) ([]Class, error) {
+	schedules, err := registar.GetClassScheduleForTimeBlock(room, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	toReturn := make([]Class, 0, len(schedules))
+	for _, s := range schedules {
+		c := Class{
+			Room:         room,
+			Start:        wallClock(s.StartTime),
+			End:          wallClock(s.EndTime),
+			TeachingArea: s.DeptName,
+			CourseNumber: s.CatalogNumber,
+			CreditHours:  s.CreditHours,
+			SectionSize:  s.SectionSize,
+			Enrollment:   s.TotalEnr,
+		}
+		if len(s.InstructorName) > 0 {
+			c.Instructors = []string{s.InstructorName}
+		}
+
+		toReturn = append(toReturn, c)
+	}
+
+	sortClasses(toReturn)
+	return toReturn, nil
+}
+
+// UAPI gets classes from the university api's room class schedules.
+type UAPI struct{}
+
+// ClassesForDay fulfills the Provider interface.
+func (UAPI) ClassesForDay(room string, day time.Time) ([]Class, error) {
+	schedules, err := uapiclassschedule.GetSimpleClassSchedulesForRoomAndDate(room, day)
+	if err != nil {
+		return nil, err
+	}
+
+	toReturn := make([]Class, 0, len(schedules))
+	for _, s := range schedules {
+		toReturn = append(toReturn, Class{
+			Room:          room,
+			Start:         wallClock(s.StartDateTime),
+			End:           wallClock(s.EndDateTime),
+			TeachingArea:  s.TeachingArea,
+			CourseNumber:  s.CourseNumber,
+			SectionNumber: s.SectionNumber,
+			ScheduleType:  s.ScheduleType,
+			Instructors:   s.InstructorNames,
+		})
+	}
+
+	sortClasses(toReturn)
+	return toReturn, nil
+}
+
+// wallClock moves a time from the class schedule apis onto Denver's wall clock. They return times with a fixed mountain standard time (-07:00) offset,
+// which is an hour off while daylight saving time is in effect, so those are read as Denver local time instead. Other times are just moved into Denver.
+func wallClock(t time.Time) time.Time {
+	if t.Location() == location {
+		return t
+	}
+
+	if name, offset := t.Zone(); offset == -7*60*60 && name != "MST" && name != "MDT" {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+	}
+
+	return t.In(location)
+}
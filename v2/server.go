@@ -9,5 +9,7 @@ import (
 
 func main() {
 	log.SetLevel("debug")
-	displayinputcaterpillar.StartDisplayInputCaterpillar(os.Args[1])
+	if err := displayinputcaterpillar.StartDisplayInputCaterpillar(os.Args[1]); err != nil {
+		log.L.Fatalf("Unable to run display input caterpillar: %v", err)
+	}
 }